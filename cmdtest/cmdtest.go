@@ -1,36 +1,155 @@
 package cmdtest
 
 import (
+	"bytes"
 	"context"
 	"errors"
+	"flag"
 	"io"
+	"os"
 	"strings"
 	"testing"
 
 	"github.com/deref/transcript/internal/core"
+	"github.com/natefinch/atomic"
 	"github.com/stretchr/testify/assert"
 )
 
+var updateFlag = flag.Bool("transcript.update", false, "update transcripts checked by cmdtest.CheckFile instead of checking them")
+
+// UpdateEnv is the environment variable that, when set to a non-empty value,
+// enables update mode like the -transcript.update test flag.
+const UpdateEnv = "TRANSCRIPT_UPDATE"
+
+func updating() bool {
+	return *updateFlag || os.Getenv(UpdateEnv) != ""
+}
+
+// Check checks the transcript read from r, with the process's working
+// directory and environment. It is equivalent to Run without options.
 func Check(t *testing.T, r io.Reader) (ok bool) {
-	ckr := &core.Checker{}
-	err := ckr.CheckTranscript(context.TODO(), r)
+	t.Helper()
+	return Run(t, r)
+}
+
+// Run checks the transcript read from r, reporting failures through t.
+func Run(t *testing.T, r io.Reader, opts ...Option) (ok bool) {
+	t.Helper()
+	ctx, ckr, ok := newChecker(t, newConfig(opts))
+	if !ok {
+		return false
+	}
+	err := ckr.CheckTranscript(ctx, r)
 	var chkErr core.CommandCheckError
 	if errors.As(err, &chkErr) {
-		t.Logf("failed check on line %d:", chkErr.Lineno)
-		t.Logf("$ %s", chkErr.Command)
-		for _, err := range chkErr.Errs {
-			t.Logf("check failed: %s", err.Error())
-			var diffErr core.DiffError
-			if errors.As(err, &diffErr) {
-				t.Log(diffErr.Plain())
-			}
-		}
-		t.Fail()
+		reportCheckError(t, chkErr)
 		return false
 	}
 	return assert.NoError(t, err)
 }
 
+func newConfig(opts []Option) *config {
+	cfg := &config{}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+// newChecker prepares to check a transcript as configured by cfg. The
+// returned context is cancelled when the test ends.
+func newChecker(t *testing.T, cfg *config) (ctx context.Context, ckr *core.Checker, ok bool) {
+	t.Helper()
+	ctx = cfg.ctx
+	if ctx == nil {
+		ctx = t.Context()
+		if deadline, ok := t.Deadline(); ok {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithDeadline(ctx, deadline)
+			t.Cleanup(cancel)
+		}
+	}
+
+	rec := &core.Recorder{
+		Dir:    cfg.dir,
+		Env:    cfg.environ(),
+		Stdout: cfg.stdout,
+		Stderr: cfg.stderr,
+
+		Commands:   cfg.commands,
+		Directives: cfg.directives,
+		// Checking never modifies files referenced by the transcript.
+		WriteFile: func(filename string, data []byte) error {
+			return nil
+		},
+	}
+	if cfg.coverDir != "" {
+		if err := os.MkdirAll(cfg.coverDir, 0755); !assert.NoError(t, err) {
+			return nil, nil, false
+		}
+	}
+	if err := rec.Init(); !assert.NoError(t, err, "initializing recorder") {
+		return nil, nil, false
+	}
+	if err := core.DeclareDeps(rec.Dir, cfg.deps...); !assert.NoError(t, err, "declaring dependencies") {
+		return nil, nil, false
+	}
+	return ctx, &core.Checker{Recorder: rec, Observer: cfg.observer}, true
+}
+
+func reportCheckError(t *testing.T, chkErr core.CommandCheckError) {
+	t.Helper()
+	t.Logf("failed check on line %d:", chkErr.Lineno)
+	t.Logf("$ %s", chkErr.Command)
+	for _, err := range chkErr.Errs {
+		t.Logf("check failed: %s", err.Error())
+		var diffErr core.DiffError
+		if errors.As(err, &diffErr) {
+			t.Log(diffErr.Plain())
+		}
+	}
+	t.Fail()
+}
+
 func CheckString(t *testing.T, cmdt string) bool {
 	return Check(t, strings.NewReader(cmdt))
 }
+
+// CheckFile checks the transcript file at path, which is relative to the
+// working directory of the test rather than to the Dir option, if any.
+//
+// When tests are run with `go test -args -transcript.update`, or with
+// TRANSCRIPT_UPDATE set in the environment, the transcript is updated instead:
+// the file is atomically rewritten with the recorded output, and the test
+// logs whether it was modified. Options apply to updates as they do to checks.
+func CheckFile(t *testing.T, path string, opts ...Option) (ok bool) {
+	t.Helper()
+	original, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return false
+	}
+	if !updating() {
+		return Run(t, bytes.NewReader(original), opts...)
+	}
+
+	ctx, ckr, ok := newChecker(t, newConfig(opts))
+	if !ok {
+		return false
+	}
+	upr := &core.Updater{
+		Recorder: ckr.Recorder,
+		Observer: ckr.Observer,
+	}
+	updated, err := upr.UpdateTranscript(ctx, bytes.NewReader(original))
+	if !assert.NoError(t, err, "updating %s", path) {
+		return false
+	}
+	if bytes.Equal(original, updated.Bytes()) {
+		return true
+	}
+	if !assert.NoError(t, atomic.WriteFile(path, updated)) {
+		return false
+	}
+	t.Logf("updated transcript: %s", path)
+	return true
+}
@@ -0,0 +1,215 @@
+package cmdtest_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/deref/transcript/cmdtest"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckFileUpdate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.cmdt")
+	stale := "# Greet.\n$ echo hello\n1 goodbye\n"
+	if !assert.NoError(t, os.WriteFile(path, []byte(stale), 0644)) {
+		return
+	}
+
+	t.Setenv(cmdtest.UpdateEnv, "1")
+	assert.True(t, cmdtest.CheckFile(t, path))
+
+	updated, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "# Greet.\n$ echo hello\n1 hello\n", string(updated))
+
+	t.Setenv(cmdtest.UpdateEnv, "")
+	assert.True(t, cmdtest.CheckFile(t, path))
+}
+
+// statusObserver collects the status of each checked command.
+type statusObserver struct {
+	statuses []cmdtest.Status
+}
+
+func (o *statusObserver) CommandStarted(ctx context.Context, lineno int, command string) {}
+
+func (o *statusObserver) CommandChecked(ctx context.Context, result *cmdtest.Result) {
+	o.statuses = append(o.statuses, result.Status)
+}
+
+func TestCheckFileUpdateOptions(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.cmdt")
+	stale := "$ basename \"$PWD\"\n1 sub\n\n$ echo hello\n1 goodbye\n"
+	if !assert.NoError(t, os.WriteFile(path, []byte(stale), 0644)) {
+		return
+	}
+	sub := filepath.Join(dir, "sub")
+	if !assert.NoError(t, os.Mkdir(sub, 0755)) {
+		return
+	}
+
+	t.Setenv(cmdtest.UpdateEnv, "1")
+	var stdout strings.Builder
+	obs := &statusObserver{}
+	assert.True(t, cmdtest.CheckFile(t, path,
+		cmdtest.Dir(sub),
+		cmdtest.Tee(&stdout, nil),
+		cmdtest.Observe(obs),
+	))
+	assert.Equal(t, "sub\nhello\n", stdout.String())
+	assert.Equal(t, []cmdtest.Status{cmdtest.Passed, cmdtest.Failed}, obs.statuses)
+
+	updated, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "$ basename \"$PWD\"\n1 sub\n\n$ echo hello\n1 hello\n", string(updated))
+
+}
+
+func TestRunOptions(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	bin := filepath.Join(dir, "bin")
+	if !assert.NoError(t, os.Mkdir(bin, 0755)) {
+		return
+	}
+	script := "#!/bin/sh\necho \"hello $NAME\"\n"
+	if !assert.NoError(t, os.WriteFile(filepath.Join(bin, "greet"), []byte(script), 0755)) {
+		return
+	}
+
+	var stdout strings.Builder
+	cmdtest.Run(t, strings.NewReader(`
+$ pwd
+1 `+dir+`
+
+$ greet
+1 hello world
+`),
+		cmdtest.Dir(dir),
+		cmdtest.Env("NAME=world"),
+		cmdtest.PrependPath(bin),
+		cmdtest.Tee(&stdout, nil),
+	)
+	assert.Equal(t, dir+"\nhello world\n", stdout.String())
+}
+
+func TestCheckFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"suite/greet/test.cmdt":    {Data: []byte("$ basename \"$PWD\"\n1 greet\n\n$ cat greeting.txt\n1< expected.txt\n")},
+		"suite/greet/greeting.txt": {Data: []byte("hello\n")},
+		"suite/greet/expected.txt": {Data: []byte("hello\n")},
+	}
+	cmdtest.CheckFS(t, fsys, "suite/*/test.cmdt")
+}
+
+func TestCheckFSOptions(t *testing.T) {
+	fsys := fstest.MapFS{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		fsys["suite/"+name+"/test.cmdt"] = &fstest.MapFile{
+			Data: []byte("$ basename \"$PWD\"\n1 " + name + "\n"),
+		}
+	}
+	// Spare capacity must not be shared by the parallel subtests.
+	opts := make([]cmdtest.Option, 0, 8)
+	opts = append(opts, cmdtest.Env("NAME=world"))
+	cmdtest.CheckFS(t, fsys, "suite/*/test.cmdt", opts...)
+}
+
+func TestRunCommands(t *testing.T) {
+	t.Parallel()
+	upper := func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		if len(args) > 1 {
+			fmt.Fprintf(stderr, "usage: %s\n", args[0])
+			return 2
+		}
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+		stdout.Write(bytes.ToUpper(data))
+		return 0
+	}
+	cmdtest.Run(t, strings.NewReader(`
+$ echo hello | upper
+1 HELLO
+
+$ upper --help
+2 usage: upper
+? 2
+
+$ exit-with 256
+? 255
+
+$ exit-with -1
+? 255
+`),
+		cmdtest.Command("upper", upper),
+		cmdtest.Command("exit-with", func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+			code, _ := strconv.Atoi(args[1])
+			return code
+		}),
+	)
+}
+
+func TestRunDirectives(t *testing.T) {
+	t.Parallel()
+	var timings []string
+	timed := func(ctx context.Context, d *cmdtest.DirectiveCall) error {
+		d.AfterNextCommand(func(res *cmdtest.CommandResult) error {
+			timings = append(timings, d.Args)
+			return nil
+		})
+		return nil
+	}
+	var codes []int
+	code := func(ctx context.Context, d *cmdtest.DirectiveCall) error {
+		d.AfterNextCommand(func(res *cmdtest.CommandResult) error {
+			codes = append(codes, res.ExitCode)
+			return nil
+		})
+		return nil
+	}
+	cmdtest.Run(t, strings.NewReader(`
+% timed greeting
+$ echo hello
+1 hello
+
+% code
+$ false
+? 1
+`),
+		cmdtest.Directive("timed", timed),
+		cmdtest.Directive("code", code),
+	)
+	assert.Equal(t, []string{"greeting"}, timings)
+	assert.Equal(t, []int{1}, codes)
+}
+
+func FuzzTranscript(f *testing.F) {
+	reverse := func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+		runes := []rune(args[1])
+		slices.Reverse(runes)
+		fmt.Fprintln(stdout, string(runes))
+		return 0
+	}
+	f.Add("hello", "world")
+	f.Add("", "")
+	cmdtest.Fuzz(f, `
+% fuzz-ignore-output
+$ reverse "$FUZZ_0$FUZZ_1"
+1 dlrowolleh
+
+$ reverse "$FUZZ_1" > /dev/null
+`, cmdtest.Command("reverse", reverse))
+}
@@ -0,0 +1,81 @@
+package cmdtest
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// CheckFS checks each transcript in fsys whose path matches pattern, using
+// the syntax of fs.Glob, in a parallel subtest named after its path.
+//
+// Transcripts are not run in place. Instead, the directory containing each
+// transcript is copied into a temporary directory of its own, which the
+// transcript then starts in. Files referenced by the transcript with `1<` or
+// `2<`, and any fixtures it reads, are therefore resolved from fsys, and the
+// transcript may freely modify them.
+func CheckFS(t *testing.T, fsys fs.FS, pattern string, opts ...Option) {
+	t.Helper()
+	matches, err := fs.Glob(fsys, pattern)
+	if !assert.NoError(t, err) {
+		return
+	}
+	if len(matches) == 0 {
+		t.Errorf("no transcripts match %q", pattern)
+		return
+	}
+	for _, name := range matches {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+			dir, err := materialize(t, fsys, path.Dir(name))
+			if !assert.NoError(t, err) {
+				return
+			}
+			f, err := fsys.Open(name)
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer f.Close()
+			Run(t, f, slices.Concat(opts, []Option{Dir(dir)})...)
+		})
+	}
+}
+
+// materialize copies the directory dir of fsys into a temporary directory,
+// and returns the path of the copy. The copy keeps the base name of dir, so
+// that transcripts observing their working directory see the same name.
+func materialize(t *testing.T, fsys fs.FS, dir string) (string, error) {
+	root := t.TempDir()
+	if dir != "." {
+		root = filepath.Join(root, path.Base(dir))
+	}
+	err := fs.WalkDir(fsys, dir, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, name)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(root, filepath.FromSlash(rel))
+		if d.IsDir() {
+			return os.MkdirAll(dst, 0755)
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return err
+		}
+		// Embedded files are read-only, but transcripts may rewrite them.
+		return os.WriteFile(dst, data, info.Mode().Perm()|0644)
+	})
+	return root, err
+}
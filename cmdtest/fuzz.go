@@ -0,0 +1,141 @@
+package cmdtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/deref/transcript/internal/core"
+	"github.com/stretchr/testify/assert"
+)
+
+var (
+	fuzzVarPattern = regexp.MustCompile(`\$\{?FUZZ_([0-9]+)`)
+	panicPattern   = regexp.MustCompile(`(?m)^panic: .*\n(?s:.*)^goroutine [0-9]+ \[`)
+)
+
+// Fuzz runs the transcript cmdt as the fuzz target of f. The transcript
+// receives the fuzz inputs, all strings, in the environment variables FUZZ_0,
+// FUZZ_1, and so on; the number of inputs is determined by the variables that
+// the transcript references. Seed inputs must be added with f.Add before
+// calling Fuzz, with one string argument for each input.
+//
+// Each command's output and exit code are checked as written, and a command
+// whose stderr shows a Go panic fails regardless. Since output usually depends
+// on the input, the output checks of a command can be disabled by preceding it
+// with the `% fuzz-ignore-output` directive:
+//
+//	% fuzz-ignore-output
+//	$ mytool parse "$FUZZ_0"
+//	? 0
+//
+// Failures are reported through t, so the fuzzing engine minimizes and
+// records the inputs that cause them.
+func Fuzz(f *testing.F, cmdt string, opts ...Option) {
+	f.Helper()
+	n := fuzzArity(cmdt)
+	if n == 0 {
+		f.Fatal("transcript does not reference any fuzz inputs, such as $FUZZ_0")
+	}
+
+	// The fuzzing engine needs a function with one parameter per input.
+	stringType := reflect.TypeOf("")
+	params := []reflect.Type{reflect.TypeOf((*testing.T)(nil))}
+	for range n {
+		params = append(params, stringType)
+	}
+	target := reflect.MakeFunc(reflect.FuncOf(params, nil, false), func(args []reflect.Value) []reflect.Value {
+		t := args[0].Interface().(*testing.T)
+		inputs := make([]string, n)
+		for i := range inputs {
+			inputs[i] = args[i+1].String()
+		}
+		fuzzTranscript(t, cmdt, inputs, newConfig(opts))
+		return nil
+	})
+	f.Fuzz(target.Interface())
+}
+
+// fuzzArity returns the number of fuzz inputs referenced by cmdt.
+func fuzzArity(cmdt string) int {
+	n := 0
+	for _, m := range fuzzVarPattern.FindAllStringSubmatch(cmdt, -1) {
+		if i, err := strconv.Atoi(m[1]); err == nil {
+			n = max(n, i+1)
+		}
+	}
+	return n
+}
+
+func fuzzTranscript(t *testing.T, cmdt string, inputs []string, cfg *config) {
+	t.Helper()
+	for i, input := range inputs {
+		if strings.ContainsRune(input, 0) {
+			t.Skip("environment variables cannot contain NUL")
+		}
+		cfg.env = append(cfg.env, fmt.Sprintf("FUZZ_%d=%s", i, input))
+	}
+
+	obs := &fuzzObserver{Observer: cfg.observer, ignored: make(map[int]bool)}
+	cfg.observer = obs
+	Directive("fuzz-ignore-output", func(ctx context.Context, d *DirectiveCall) error {
+		obs.ignoreNext = true
+		return nil
+	})(cfg)
+
+	ctx, ckr, ok := newChecker(t, cfg)
+	if !ok {
+		return
+	}
+	results, err := ckr.CheckTranscriptResults(ctx, strings.NewReader(cmdt))
+	for _, res := range results {
+		if panicPattern.MatchString(res.ActualStreams[2]) {
+			t.Errorf("command on line %d panicked:\n$ %s\n%s", res.Lineno, res.Command, res.ActualStreams[2])
+			continue
+		}
+		var errs []error
+		for _, err := range res.Errs {
+			var diffErr core.DiffError
+			if obs.ignored[res.Lineno] && errors.As(err, &diffErr) {
+				continue
+			}
+			errs = append(errs, err)
+		}
+		if len(errs) > 0 {
+			reportCheckError(t, core.CommandCheckError{
+				Command: res.Command,
+				Lineno:  res.Lineno,
+				Errs:    errs,
+			})
+		}
+	}
+	assert.NoError(t, err)
+}
+
+// fuzzObserver notes the commands whose output is ignored under fuzzing.
+type fuzzObserver struct {
+	Observer   // Optional.
+	ignoreNext bool
+	ignored    map[int]bool // By line number.
+}
+
+func (obs *fuzzObserver) CommandStarted(ctx context.Context, lineno int, command string) {
+	if obs.ignoreNext {
+		obs.ignored[lineno] = true
+		obs.ignoreNext = false
+	}
+	if obs.Observer != nil {
+		obs.Observer.CommandStarted(ctx, lineno, command)
+	}
+}
+
+func (obs *fuzzObserver) CommandChecked(ctx context.Context, result *Result) {
+	if obs.Observer != nil {
+		obs.Observer.CommandChecked(ctx, result)
+	}
+}
@@ -0,0 +1,93 @@
+package cmdtest
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// Main runs the tests of m, with the given commands available to transcripts
+// on PATH. Call it from TestMain:
+//
+//	func TestMain(m *testing.M) {
+//		cmdtest.Main(m, map[string]func() int{
+//			"mytool": mytool.Main,
+//		})
+//	}
+//
+// Each command is implemented by re-executing the test binary under the
+// command's name, which then calls the command's function and exits with the
+// code it returns. The tool under test therefore runs the code built into
+// the test binary, without a separate build step.
+func Main(m *testing.M, commands map[string]func() int) {
+	name := filepath.Base(os.Args[0])
+	if runtime.GOOS == "windows" {
+		name = strings.TrimSuffix(name, ".exe")
+	}
+	if fn, ok := commands[name]; ok {
+		os.Exit(fn())
+	}
+	os.Exit(runMain(m, commands))
+}
+
+func runMain(m *testing.M, commands map[string]func() int) int {
+	binDir, err := os.MkdirTemp("", "cmdtest-bin-")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "cmdtest: %v\n", err)
+		return 1
+	}
+	defer os.RemoveAll(binDir)
+	if err := installCommands(binDir, commands); err != nil {
+		fmt.Fprintf(os.Stderr, "cmdtest: installing commands: %v\n", err)
+		return 1
+	}
+	path := binDir
+	if oldPath := os.Getenv("PATH"); oldPath != "" {
+		path += string(os.PathListSeparator) + oldPath
+	}
+	os.Setenv("PATH", path)
+	return m.Run()
+}
+
+// installCommands links each command name in binDir to the test binary,
+// copying the binary where links are not supported.
+func installCommands(binDir string, commands map[string]func() int) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	for name := range commands {
+		target := filepath.Join(binDir, name)
+		if runtime.GOOS == "windows" {
+			target += ".exe"
+		}
+		if err := os.Symlink(exe, target); err == nil {
+			continue
+		}
+		if err := copyExecutable(exe, target); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func copyExecutable(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
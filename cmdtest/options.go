@@ -0,0 +1,198 @@
+package cmdtest
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/deref/transcript/internal/core"
+)
+
+// Option configures Run.
+type Option func(*config)
+
+type config struct {
+	ctx    context.Context
+	dir    string
+	env    []string
+	path   []string
+	stdout io.Writer
+	stderr io.Writer
+
+	commands   map[string]CommandFunc
+	directives map[string]DirectiveFunc
+	coverDir   string
+	observer   Observer
+	deps       []string
+}
+
+// CommandFunc implements a command in Go. It is called with the command's
+// arguments, including the command name as args[0], and its standard
+// streams, and returns the command's exit code, which ranges from 0 to 255.
+// Codes outside that range are reported as 255.
+type CommandFunc = core.CommandFunc
+
+// Command makes a Go function available to the transcript as a command named
+// name, which runs in the test process. This is useful for test helpers, such
+// as fake services, that would otherwise need binaries of their own.
+func Command(name string, fn CommandFunc) Option {
+	return func(cfg *config) {
+		if cfg.commands == nil {
+			cfg.commands = make(map[string]CommandFunc)
+		}
+		cfg.commands[name] = fn
+	}
+}
+
+// Dir sets the initial working directory of the transcript's shell. Relative
+// directories are resolved against the working directory of the test.
+func Dir(dir string) Option {
+	return func(cfg *config) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		cfg.dir = dir
+	}
+}
+
+// Env sets environment variables, given as "NAME=value" entries, in addition
+// to those inherited from the test process.
+func Env(vars ...string) Option {
+	return func(cfg *config) {
+		cfg.env = append(cfg.env, vars...)
+	}
+}
+
+// PrependPath adds directories to the front of PATH, such as a directory
+// holding freshly built binaries of the tool under test. Relative directories
+// are resolved against the working directory of the test.
+func PrependPath(dirs ...string) Option {
+	return func(cfg *config) {
+		for _, dir := range dirs {
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			cfg.path = append(cfg.path, dir)
+		}
+	}
+}
+
+// DirectiveFunc implements a custom `% name args` directive.
+type DirectiveFunc = core.DirectiveFunc
+
+// DirectiveCall is an occurrence of a custom directive in a transcript,
+// through which its implementation can access the session.
+type DirectiveCall = core.Directive
+
+// CommandResult is the result of a command, as seen by directives.
+type CommandResult = core.CommandResult
+
+// Directive makes a custom `% name args` directive available to the
+// transcript. Custom directives run between commands, and can inspect the
+// result of the next command with DirectiveCall.AfterNextCommand.
+func Directive(name string, fn DirectiveFunc) Option {
+	return func(cfg *config) {
+		if cfg.directives == nil {
+			cfg.directives = make(map[string]DirectiveFunc)
+		}
+		cfg.directives[name] = fn
+	}
+}
+
+// CoverDir sets GOCOVERDIR for every command, so that Go binaries built with
+// `go build -cover` write their coverage counters to dir. The counters of all
+// commands, across transcripts, can then be merged and reported with
+// `go tool covdata`, for example:
+//
+//	go tool covdata percent -i=dir
+//	go tool covdata textfmt -i=dir -o=cover.out
+//
+// Binaries run with cmdtest.Main need no such option, as `go test -cover`
+// already collects their coverage.
+func CoverDir(dir string) Option {
+	return func(cfg *config) {
+		if abs, err := filepath.Abs(dir); err == nil {
+			dir = abs
+		}
+		cfg.coverDir = dir
+	}
+}
+
+// Result describes a command that was run and checked.
+type Result = core.CheckResult
+
+// Status is the outcome of checking a command.
+type Status = core.CheckStatus
+
+const (
+	Passed = core.CheckPassed
+	Failed = core.CheckFailed
+)
+
+// Observer is notified as each command of a transcript is run and checked.
+type Observer = core.Observer
+
+// Observe reports the progress of the transcript to o, for example to
+// collect timings or to build a custom report.
+// When updating, commands are checked against their expectations as they were
+// before the update.
+func Observe(o Observer) Option {
+	return func(cfg *config) {
+		cfg.observer = o
+	}
+}
+
+// Dep declares dependencies of the test, like a `% dep` directive, so that
+// changes to them invalidate cached test results. Arguments starting with `$`
+// name environment variables, and others are file paths, which are relative
+// to the Dir option, if any.
+func Dep(args ...string) Option {
+	return func(cfg *config) {
+		cfg.deps = append(cfg.deps, args...)
+	}
+}
+
+// Context sets the context that commands are run with. It defaults to the
+// test's context, bounded by the test's deadline, if any.
+func Context(ctx context.Context) Option {
+	return func(cfg *config) {
+		cfg.ctx = ctx
+	}
+}
+
+// Tee copies the output of commands to the given writers as they run, which
+// helps with debugging hanging or slow transcripts. Either may be nil.
+func Tee(stdout, stderr io.Writer) Option {
+	return func(cfg *config) {
+		cfg.stdout = stdout
+		cfg.stderr = stderr
+	}
+}
+
+// environ returns the environment overrides of the config, including PATH
+// and GOCOVERDIR.
+func (cfg *config) environ() []string {
+	env := cfg.env
+	if cfg.coverDir != "" {
+		env = append(slices.Clone(env), "GOCOVERDIR="+cfg.coverDir)
+	}
+	if len(cfg.path) == 0 {
+		return env
+	}
+	path := os.Getenv("PATH")
+	for _, kv := range cfg.env {
+		if name, value, ok := strings.Cut(kv, "="); ok && name == "PATH" {
+			path = value
+		}
+	}
+	dirs := strings.Join(cfg.path, string(os.PathListSeparator))
+	if path != "" {
+		path = dirs + string(os.PathListSeparator) + path
+	} else {
+		path = dirs
+	}
+	return append(slices.Clone(env), "PATH="+path)
+}
@@ -18,12 +18,19 @@ import (
 func init() {
 	checkCmd.Flags().IntVarP(&checkFlags.Jobs, "jobs", "j", 0, "maximum number of transcript files to check in parallel (0 = GOMAXPROCS)")
 	checkCmd.Flags().BoolVarP(&checkFlags.Verbose, "verbose", "v", false, "verbose output")
+	checkCmd.Flags().BoolVar(&checkFlags.WritePending, "write-pending", false, "save proposed updates for failing transcripts as *.pending files")
+	checkCmd.Flags().StringVar(&checkFlags.CoverDir, "cover-dir", "", "collect coverage of Go binaries built with -cover into this directory")
+	checkCmd.Flags().StringVar(&checkFlags.CoverProfile, "cover-profile", "", "with --cover-dir, also write a coverage profile to this file")
+	addMarkdownSessionFlag(checkCmd)
 	rootCmd.AddCommand(checkCmd)
 }
 
 var checkFlags struct {
-	Jobs    int
-	Verbose bool
+	Jobs         int
+	Verbose      bool
+	WritePending bool
+	CoverDir     string
+	CoverProfile string
 }
 
 var checkCmd = &cobra.Command{
@@ -33,21 +40,53 @@ var checkCmd = &cobra.Command{
 
 When multiple transcripts are provided, checks run in parallel by default.
 Use -j 1 to force sequential checking if your transcripts share mutable
-external state.`,
+external state.
+
+With --write-pending, each failing transcript is re-run in update mode and the
+result is saved next to it with a .pending suffix, ready for
+'transcript review'.
+
+Markdown files (*.md) are checked by running their fenced cmdt code blocks.
+By default, all of a file's blocks run in one shell session. Use
+--markdown-session=block to run each block in a session of its own.
+
+With --cover-dir, GOCOVERDIR is set for every command, so that Go binaries
+built with 'go build -cover' write coverage counters to the given directory.
+After checking, the counters of all commands are merged and summarized by
+package. Add --cover-profile to also write a profile for 'go tool cover'.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		if len(args) == 0 {
 			warnf("no transcripts to check")
 			os.Exit(1)
 		}
+		if checkFlags.CoverProfile != "" && checkFlags.CoverDir == "" {
+			return fmt.Errorf("--cover-profile requires --cover-dir")
+		}
+		var env []string
+		if checkFlags.CoverDir != "" {
+			var err error
+			env, err = coverEnv(checkFlags.CoverDir)
+			if err != nil {
+				return fmt.Errorf("setting up coverage: %w", err)
+			}
+		}
 		failures, err := runCheck(cmd.Context(), checkOptions{
 			Filenames: args,
 			Out:       cmd.OutOrStdout(),
 			Jobs:      checkFlags.Jobs,
 			Verbose:   checkFlags.Verbose,
+			Env:       env,
+
+			WritePending: checkFlags.WritePending,
 		})
 		if err != nil {
 			return err
 		}
+		if checkFlags.CoverDir != "" {
+			if err := reportCoverage(cmd.OutOrStdout(), checkFlags.CoverDir, checkFlags.CoverProfile); err != nil {
+				return fmt.Errorf("reporting coverage: %w", err)
+			}
+		}
 		if failures > 0 {
 			os.Exit(1)
 		}
@@ -60,6 +99,13 @@ type checkOptions struct {
 	Out       io.Writer
 	Jobs      int
 	Verbose   bool
+	// Environment variable overrides, as "NAME=value" entries, for commands.
+	Env []string
+
+	// WritePending saves proposed updates for failing transcripts.
+	WritePending bool
+	// If provided, called with the outcome of each transcript, in order.
+	Report func(filename string, ok bool)
 }
 
 func runCheck(ctx context.Context, opts checkOptions) (failures int, err error) {
@@ -115,7 +161,17 @@ func runCheck(ctx context.Context, opts checkOptions) (failures int, err error)
 					if !ok {
 						return
 					}
-					ok, output, dur, err := checkFile(ctx, t.filename)
+					ok, output, dur, err := checkFile(ctx, t.filename, opts.Env)
+					if err == nil && opts.WritePending {
+						if ok {
+							err = removePending(t.filename)
+						} else {
+							err = writePending(ctx, t.filename, opts.Env)
+						}
+						if err != nil {
+							err = fmt.Errorf("writing pending update for %q: %w", t.filename, err)
+						}
+					}
 					if err != nil {
 						cancel()
 					}
@@ -164,44 +220,68 @@ func runCheck(ctx context.Context, opts checkOptions) (failures int, err error)
 			if !res.ok {
 				failures++
 			}
+			if opts.Report != nil && res.err == nil {
+				opts.Report(filenames[nextToPrint], res.ok)
+			}
 			nextToPrint++
 		}
 	}
 	return failures, firstErr
 }
 
-func checkFile(ctx context.Context, filename string) (ok bool, output string, dur time.Duration, err error) {
+func checkFile(ctx context.Context, filename string, env []string) (ok bool, output string, dur time.Duration, err error) {
 	start := time.Now()
 	var buf bytes.Buffer
-	ok, err = checkFileToWriter(ctx, filename, &buf)
+	ok, err = checkFileToWriter(ctx, filename, env, &buf)
 	return ok, buf.String(), time.Since(start), err
 }
 
-func checkFileToWriter(ctx context.Context, filename string, out io.Writer) (ok bool, err error) {
+func checkFileToWriter(ctx context.Context, filename string, env []string, out io.Writer) (ok bool, err error) {
+	if core.IsMarkdown(filename) {
+		return checkMarkdown(ctx, filename, env, out)
+	}
+
 	f, err := os.Open(filename)
 	if err != nil {
 		return false, err
 	}
 	defer f.Close()
 
-	ckr := &core.Checker{}
+	ckr, err := newChecker(env)
+	if err != nil {
+		return false, err
+	}
 	err = ckr.CheckTranscript(ctx, f)
 	var chkErr core.CommandCheckError
 	if errors.As(err, &chkErr) {
-		fmt.Fprintf(out, "failed check at %s:%d\n", filename, chkErr.Lineno)
-		fmt.Fprintf(out, "$ %s\n", chkErr.Command)
-		for _, err := range chkErr.Errs {
-			fmt.Fprintln(out, err.Error())
-			var diffErr core.DiffError
-			if errors.As(err, &diffErr) {
-				if color {
-					fmt.Fprint(out, diffErr.Color())
-				} else {
-					fmt.Fprint(out, diffErr.Plain())
-				}
-			}
-		}
+		printCheckError(out, filename, chkErr)
 		return false, nil
 	}
 	return err == nil, err
 }
+
+// newChecker returns a checker whose commands run with the given environment
+// overrides.
+func newChecker(env []string) (*core.Checker, error) {
+	rec := &core.Recorder{Env: env}
+	if err := rec.Init(); err != nil {
+		return nil, fmt.Errorf("initializing recorder: %w", err)
+	}
+	return &core.Checker{Recorder: rec}, nil
+}
+
+func printCheckError(out io.Writer, filename string, chkErr core.CommandCheckError) {
+	fmt.Fprintf(out, "failed check at %s:%d\n", filename, chkErr.Lineno)
+	fmt.Fprintf(out, "$ %s\n", chkErr.Command)
+	for _, err := range chkErr.Errs {
+		fmt.Fprintln(out, err.Error())
+		var diffErr core.DiffError
+		if errors.As(err, &diffErr) {
+			if color {
+				fmt.Fprint(out, diffErr.Color())
+			} else {
+				fmt.Fprint(out, diffErr.Plain())
+			}
+		}
+	}
+}
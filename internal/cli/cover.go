@@ -0,0 +1,62 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// coverEnv returns the environment that directs coverage counters of Go
+// binaries built with `go build -cover` to dir, creating it if necessary.
+func coverEnv(dir string) ([]string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return []string{"GOCOVERDIR=" + dir}, nil
+}
+
+// reportCoverage summarizes the coverage counters in dir by package, merging
+// the counters of every command run. If profile is non-empty, the counters
+// are also converted to a profile for `go tool cover`.
+func reportCoverage(out io.Writer, dir, profile string) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, entry := range entries {
+		if strings.HasPrefix(entry.Name(), "covcounters.") {
+			found = true
+			break
+		}
+	}
+	if !found {
+		warnf("no coverage data in %s; build commands with go build -cover", dir)
+		return nil
+	}
+
+	if err := runCovdata(out, "percent", "-i="+dir); err != nil {
+		return err
+	}
+	if profile != "" {
+		return runCovdata(out, "textfmt", "-i="+dir, "-o="+profile)
+	}
+	return nil
+}
+
+func runCovdata(out io.Writer, args ...string) error {
+	cmd := exec.Command("go", append([]string{"tool", "covdata"}, args...)...)
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("go tool covdata %s: %w", args[0], err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/deref/transcript/internal/export"
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	exportCmd.Flags().StringVarP(&exportFlags.Format, "format", "f", "markdown", "output format: markdown, html, or asciicast")
+	exportCmd.Flags().StringVarP(&exportFlags.OutputPath, "output", "o", "", "output file path (default stdout)")
+	exportCmd.Flags().StringVar(&exportFlags.Title, "title", "", "title of the exported document")
+	rootCmd.AddCommand(exportCmd)
+}
+
+var exportFlags struct {
+	Format     string
+	OutputPath string
+	Title      string
+}
+
+var exporters = map[string]func(io.Writer, *export.Transcript, export.Options) error{
+	"markdown":  export.Markdown,
+	"html":      export.HTML,
+	"asciicast": export.Asciicast,
+}
+
+var exportCmd = &cobra.Command{
+	Use:   "export <transcript>",
+	Short: "Renders a transcript for publishing",
+	Long: `Renders a transcript as documentation or as a terminal recording.
+
+The transcript is not run; its recorded commands and expectations are
+rendered as written. Comments become prose, and files referenced with 1< / 2<
+become links.
+
+Formats:
+
+  markdown   Markdown, with each command in a console code block.
+  html       A standalone HTML page, with stdout and stderr styled differently.
+  asciicast  An asciicast v2 recording for asciinema, re-timed as if each
+             command were typed at a prompt.
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		render, ok := exporters[exportFlags.Format]
+		if !ok {
+			return fmt.Errorf("unknown format %q: expected markdown, html, or asciicast", exportFlags.Format)
+		}
+
+		filename := args[0]
+		f, err := os.Open(filename)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		t, err := export.Parse(cmd.Context(), f)
+		if err != nil {
+			return fmt.Errorf("parsing %q: %w", filename, err)
+		}
+
+		// Link to referenced files relative to where the output is written.
+		outDir := "."
+		if exportFlags.OutputPath != "" {
+			outDir = filepath.Dir(exportFlags.OutputPath)
+		}
+		opts := export.Options{
+			Title: exportFlags.Title,
+			Link: func(file string) string {
+				target := filepath.Join(filepath.Dir(filename), file)
+				if rel, err := filepath.Rel(outDir, target); err == nil {
+					target = rel
+				}
+				return filepath.ToSlash(target)
+			},
+		}
+
+		var buf bytes.Buffer
+		if err := render(&buf, t, opts); err != nil {
+			return err
+		}
+		if exportFlags.OutputPath == "" {
+			_, err := buf.WriteTo(cmd.OutOrStdout())
+			return err
+		}
+		return atomic.WriteFile(exportFlags.OutputPath, &buf)
+	},
+}
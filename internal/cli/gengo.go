@@ -0,0 +1,77 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+
+	"github.com/deref/transcript/internal/gengo"
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	genGoCmd.Flags().StringVarP(&genGoFlags.OutputPath, "output", "o", "transcript_gen_test.go", "output file, relative to the directory, or - for stdout")
+	genGoCmd.Flags().StringVar(&genGoFlags.Pattern, "pattern", "*.cmdt", "file names of transcripts to generate tests for")
+	genGoCmd.Flags().StringVar(&genGoFlags.Package, "package", "", "package of the generated file (default: the package in the directory)")
+	rootCmd.AddCommand(genGoCmd)
+}
+
+var genGoFlags struct {
+	OutputPath string
+	Pattern    string
+	Package    string
+}
+
+var genGoCmd = &cobra.Command{
+	Use:   "gen-go [dir]",
+	Short: "Generates Go tests for transcripts",
+	Long: `Generates a Go test file that checks every transcript in a directory tree.
+
+Each *.cmdt file, or each file whose name matches --pattern, gets a test
+function of its own, named after its path, which checks the transcript with
+cmdtest.CheckFile. The transcript runs in its own directory, and files it
+references with 1< / 2< or % dep are declared as dependencies, so that
+changes to them invalidate cached test results.
+
+The directory defaults to the current one, which suits go:generate:
+
+  //go:generate transcript gen-go
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		dir := "."
+		if len(args) > 0 {
+			dir = args[0]
+		}
+		pkg := genGoFlags.Package
+		if pkg == "" {
+			var err error
+			pkg, err = gengo.PackageName(dir)
+			if err != nil {
+				return err
+			}
+		}
+		tests, err := gengo.Find(dir, genGoFlags.Pattern)
+		if err != nil {
+			return err
+		}
+		if len(tests) == 0 {
+			return fmt.Errorf("no transcripts found in %s", dir)
+		}
+		src, err := gengo.Generate(tests, gengo.Options{Package: pkg})
+		if err != nil {
+			return err
+		}
+
+		if genGoFlags.OutputPath == "-" {
+			_, err := cmd.OutOrStdout().Write(src)
+			return err
+		}
+		output := genGoFlags.OutputPath
+		if !filepath.IsAbs(output) {
+			output = filepath.Join(dir, output)
+		}
+		return atomic.WriteFile(output, bytes.NewReader(src))
+	},
+}
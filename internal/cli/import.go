@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deref/transcript/internal/importer"
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	importCmd.Flags().StringVar(&importFlags.From, "from", "", "format to convert from: "+strings.Join(importer.Formats(), ", "))
+	importCmd.Flags().StringVarP(&importFlags.OutputPath, "output", "o", "", "output file path, or - for stdout (only with a single input)")
+	importCmd.Flags().BoolVarP(&importFlags.Force, "force", "f", false, "overwrite existing transcripts")
+	_ = importCmd.MarkFlagRequired("from")
+	rootCmd.AddCommand(importCmd)
+}
+
+var importFlags struct {
+	From       string
+	OutputPath string
+	Force      bool
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import --from=<format> <files...>",
+	Short: "Converts tests from other formats to transcripts",
+	Long: `Converts tests written for other command-line testing tools to transcript
+files.
+
+Supported formats:
+
+  cram        cram tests (*.t)
+  testscript  Go testscript archives (*.txtar)
+  bats        bats tests (*.bats)
+
+Each input is converted to a transcript alongside it, with a .cmdt extension,
+unless --output is given.
+
+Constructs that can't be translated exactly, such as regular expression
+output checks, are reported as warnings and noted in the transcript with
+"# import:" comments. Run 'transcript update' on the converted transcripts to
+fill in exact expectations, then review the flagged commands.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		convert, ok := importer.Converters[importFlags.From]
+		if !ok {
+			return fmt.Errorf("unknown format %q: expected one of %s", importFlags.From, strings.Join(importer.Formats(), ", "))
+		}
+		if len(args) == 0 {
+			warnf("no files to import")
+			os.Exit(1)
+		}
+		if importFlags.OutputPath != "" && len(args) > 1 {
+			return fmt.Errorf("--output requires a single input")
+		}
+
+		warnings := 0
+		for _, filename := range args {
+			n, err := importFile(cmd, convert, filename)
+			if err != nil {
+				return fmt.Errorf("importing %q: %w", filename, err)
+			}
+			warnings += n
+		}
+		if warnings > 0 {
+			warnf("%d constructs could not be translated; search for %q", warnings, strings.TrimSpace(importer.WarningPrefix))
+		}
+		return nil
+	},
+}
+
+func importFile(cmd *cobra.Command, convert importer.Converter, filename string) (warnings int, err error) {
+	outputPath := importFlags.OutputPath
+	if outputPath == "" {
+		outputPath = strings.TrimSuffix(filename, filepath.Ext(filename)) + ".cmdt"
+	}
+	if outputPath != "-" && !importFlags.Force {
+		if _, err := os.Stat(outputPath); err == nil {
+			return 0, fmt.Errorf("%s already exists (use --force to overwrite)", outputPath)
+		}
+	}
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	res, err := convert(filename, f)
+	if err != nil {
+		return 0, err
+	}
+	for _, w := range res.Warnings {
+		warnf("%s", w)
+	}
+
+	if outputPath == "-" {
+		_, err = cmd.OutOrStdout().Write(res.Transcript)
+	} else {
+		err = atomic.WriteFile(outputPath, bytes.NewReader(res.Transcript))
+	}
+	return len(res.Warnings), err
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/deref/transcript/internal/core"
+	"github.com/spf13/cobra"
+)
+
+// markdownSession is how the ```cmdt blocks of Markdown documents are run:
+// "file" runs all of a document's blocks in one shell session, and "block"
+// runs each block in a session of its own.
+var markdownSession string
+
+func addMarkdownSessionFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&markdownSession, "markdown-session", "file", "run the cmdt blocks of Markdown files in one session per file or per block")
+}
+
+// markdownTranscripts returns the transcripts to run for a Markdown
+// document, one per session.
+func markdownTranscripts(doc *core.MarkdownDoc) ([][]byte, error) {
+	if doc.NumBlocks() == 0 {
+		return nil, nil
+	}
+	switch markdownSession {
+	case "file":
+		return [][]byte{doc.Transcript()}, nil
+	case "block":
+		transcripts := make([][]byte, doc.NumBlocks())
+		for i := range transcripts {
+			transcripts[i] = doc.Transcript(i)
+		}
+		return transcripts, nil
+	default:
+		return nil, fmt.Errorf("invalid --markdown-session %q: expected file or block", markdownSession)
+	}
+}
+
+func checkMarkdown(ctx context.Context, filename string, env []string, out io.Writer) (ok bool, err error) {
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+	doc, err := core.ParseMarkdown(data)
+	if err != nil {
+		return false, err
+	}
+	transcripts, err := markdownTranscripts(doc)
+	if err != nil {
+		return false, err
+	}
+
+	ok = true
+	for _, transcript := range transcripts {
+		ckr, err := newChecker(env)
+		if err != nil {
+			return false, err
+		}
+		err = ckr.CheckTranscript(ctx, bytes.NewReader(transcript))
+		var chkErr core.CommandCheckError
+		if errors.As(err, &chkErr) {
+			printCheckError(out, filename, chkErr)
+			ok = false
+			continue
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+	return ok, nil
+}
+
+// updateContent runs the updater over a transcript, or over the ```cmdt blocks
+// of a Markdown document, and returns the updated file contents.
+func updateContent(ctx context.Context, filename string, original []byte, newUpdater func() *core.Updater) ([]byte, error) {
+	if !core.IsMarkdown(filename) {
+		transcript, err := newUpdater().UpdateTranscript(ctx, bytes.NewReader(original))
+		if err != nil {
+			return nil, err
+		}
+		return transcript.Bytes(), nil
+	}
+
+	doc, err := core.ParseMarkdown(original)
+	if err != nil {
+		return nil, err
+	}
+	transcripts, err := markdownTranscripts(doc)
+	if err != nil {
+		return nil, err
+	}
+	for _, transcript := range transcripts {
+		updated, err := newUpdater().UpdateTranscript(ctx, bytes.NewReader(transcript))
+		if err != nil {
+			return nil, err
+		}
+		if err := doc.ApplyTranscript(updated.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	return doc.Bytes(), nil
+}
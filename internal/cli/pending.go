@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+
+	"github.com/deref/transcript/internal/core"
+	"github.com/natefinch/atomic"
+)
+
+// pendingSuffix is appended to the names of transcripts (and of the files
+// they reference) to hold proposed updates awaiting review.
+const pendingSuffix = ".pending"
+
+// writePending runs the updater over a transcript and saves the result
+// alongside it for later review. Referenced files whose contents would change
+// are saved the same way, rather than being overwritten.
+func writePending(ctx context.Context, filename string, env []string) error {
+	original, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	updated, err := updateContent(ctx, filename, original, func() *core.Updater {
+		return &core.Updater{
+			Env: env,
+			WriteFile: func(ref string, data []byte) error {
+				existing, err := os.ReadFile(ref)
+				if err == nil && bytes.Equal(existing, data) {
+					return nil
+				}
+				return atomic.WriteFile(ref+pendingSuffix, bytes.NewReader(data))
+			},
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return atomic.WriteFile(filename+pendingSuffix, bytes.NewReader(updated))
+}
+
+// removePending discards any proposed update for a transcript.
+func removePending(filename string) error {
+	err := os.Remove(filename + pendingSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,70 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/deref/transcript/internal/core"
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	recordCmd.Flags().StringVarP(&recordFlags.OutputPath, "output", "o", "", "output file path (default stdout)")
+	recordCmd.Flags().Var(&recordFlags.Externalize, "externalize-over", "write text output over this many lines (or bytes, like 16kb) to a file")
+	rootCmd.AddCommand(recordCmd)
+}
+
+var recordFlags struct {
+	OutputPath  string
+	Externalize core.ExternalizeLimit
+}
+
+var recordCmd = &cobra.Command{
+	Use:   "record <script>",
+	Short: "Records a transcript from a shell script",
+	Long: `Runs a shell script one top-level statement at a time, and writes a
+transcript of it.
+
+Each statement is recorded as a command, along with its output and exit code.
+Comments and blank lines between statements are kept, and statements that span
+several lines are recorded with > continuation lines. A leading #! line is
+skipped.
+
+If the script exits because a command fails under set -e, the failing
+command and its exit code are recorded, and recording stops with a warning.
+
+If --output is not specified, the transcript is written to stdout.
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		f, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+
+		rec := &core.Recorder{
+			Externalize: recordFlags.Externalize,
+		}
+		if err := rec.Init(); err != nil {
+			return fmt.Errorf("initializing: %w", err)
+		}
+		err = rec.RecordScript(ctx, f)
+		var exitErr core.ScriptExitError
+		if errors.As(err, &exitErr) {
+			// Keep what was recorded, which ends with the failing command.
+			warnf("recording %q stopped: %v", args[0], err)
+		} else if err != nil {
+			return fmt.Errorf("recording %q: %w", args[0], err)
+		}
+
+		if recordFlags.OutputPath == "" {
+			_, err := rec.Transcript.WriteTo(cmd.OutOrStdout())
+			return err
+		}
+		return atomic.WriteFile(recordFlags.OutputPath, &rec.Transcript)
+	},
+}
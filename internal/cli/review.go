@@ -0,0 +1,127 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/deref/transcript/internal/interactive"
+	"github.com/natefinch/atomic"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	rootCmd.AddCommand(reviewCmd)
+}
+
+var reviewCmd = &cobra.Command{
+	Use:   "review [transcripts...]",
+	Short: "Reviews pending transcript updates",
+	Long: `Reviews pending transcript updates.
+
+Pending updates are written by 'transcript check --write-pending'. For each
+command whose expectations changed, the difference is shown and you are asked
+to accept, reject, or skip it. Accepted changes are written back to the
+transcript. Skipped changes remain pending for a later review.
+
+If no transcripts are given, all *.cmdt.pending files beneath the current
+directory are reviewed.
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filenames := args
+		if len(filenames) == 0 {
+			var err error
+			filenames, err = findPending(".")
+			if err != nil {
+				return err
+			}
+		}
+		rv := &interactive.Review{
+			In:    cmd.InOrStdin(),
+			Out:   cmd.OutOrStdout(),
+			Color: color,
+		}
+		for _, filename := range filenames {
+			filename = strings.TrimSuffix(filename, pendingSuffix)
+			if err := reviewFile(rv, filename); err != nil {
+				return fmt.Errorf("reviewing %q: %w", filename, err)
+			}
+			if rv.Quit() {
+				break
+			}
+		}
+		return nil
+	},
+}
+
+func findPending(root string) ([]string, error) {
+	var filenames []string
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && strings.HasSuffix(path, ".cmdt"+pendingSuffix) {
+			filenames = append(filenames, path)
+		}
+		return nil
+	})
+	return filenames, err
+}
+
+func reviewFile(rv *interactive.Review, filename string) error {
+	original, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	pending, err := os.ReadFile(filename + pendingSuffix)
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("no pending update")
+	}
+	if err != nil {
+		return err
+	}
+
+	res, err := rv.ReviewTranscript(filename, original, pending)
+	if err != nil {
+		return err
+	}
+
+	for _, seg := range res.Accepted {
+		for _, ref := range seg.FileRefs() {
+			err := os.Rename(ref+pendingSuffix, ref)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	for _, seg := range res.Rejected {
+		for _, ref := range seg.FileRefs() {
+			err := os.Remove(ref + pendingSuffix)
+			if err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	if len(res.Accepted) > 0 {
+		if err := atomic.WriteFile(filename, bytes.NewReader(res.Transcript)); err != nil {
+			return err
+		}
+	}
+	if res.Pending == nil {
+		if err := removePending(filename); err != nil {
+			return err
+		}
+	} else {
+		if err := atomic.WriteFile(filename+pendingSuffix, bytes.NewReader(res.Pending)); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(rv.Out, "%s: %d accepted, %d rejected, %d skipped\n",
+		filename, len(res.Accepted), len(res.Rejected), len(res.Skipped))
+	return nil
+}
@@ -1,20 +1,26 @@
 package cli
 
 import (
+	"errors"
 	"fmt"
 	"os"
 
+	"github.com/deref/transcript/internal/core"
 	"github.com/deref/transcript/internal/interactive"
 	"github.com/spf13/cobra"
 )
 
 func init() {
 	shellCmd.Flags().StringVarP(&shellFlags.OutputPath, "output", "o", "", "output file path")
+	shellCmd.Flags().StringVarP(&shellFlags.AppendPath, "append", "a", "", "existing transcript to replay and then append to")
+	shellCmd.Flags().Var(&shellFlags.Externalize, "externalize-over", "write text output over this many lines (or bytes, like 16kb) to a file")
 	rootCmd.AddCommand(shellCmd)
 }
 
 var shellFlags struct {
-	OutputPath string
+	OutputPath  string
+	AppendPath  string
+	Externalize core.ExternalizeLimit
 }
 
 var shellCmd = &cobra.Command{
@@ -24,31 +30,58 @@ var shellCmd = &cobra.Command{
 a file.
 
 If --output is not specified, a tempfile will be written.
+
+With --append, an existing transcript is checked first, restoring the shell
+state it leaves behind (working directory, variables, functions). New commands
+are then appended to it, and the result is written back to the same file
+unless --output is also given.
+
+Lines beginning with a colon are meta-commands that edit the transcript being
+recorded. For example, :undo removes the last command from the transcript and
+:show prints the transcript so far. Type :help for a list.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
-		sh := &interactive.Shell{}
-		if err := sh.Run(ctx); err != nil {
-			return err
+		outputPath := shellFlags.OutputPath
+		if outputPath == "" {
+			outputPath = shellFlags.AppendPath
+		}
+		var existing []byte
+		if shellFlags.AppendPath != "" {
+			var err error
+			existing, err = os.ReadFile(shellFlags.AppendPath)
+			if err != nil {
+				return err
+			}
+		}
+		if outputPath == "" {
+			file, err := os.CreateTemp("", "transcript")
+			if err != nil {
+				return fmt.Errorf("creating output: %w", err)
+			}
+			_ = file.Close()
+			outputPath = file.Name()
 		}
 
-		var file *os.File
-		var err error
-		if shellFlags.OutputPath == "" {
-			file, err = os.CreateTemp("", "transcript")
-		} else {
-			file, err = os.OpenFile(shellFlags.OutputPath, os.O_CREATE|os.O_TRUNC|os.O_RDWR, 0600)
+		sh := &interactive.Shell{
+			Externalize: shellFlags.Externalize,
+			OutputPath:  outputPath,
+			Append:      existing,
 		}
-		if err != nil {
-			return fmt.Errorf("creating output: %w", err)
+		if err := sh.Run(ctx); err != nil {
+			var chkErr core.CommandCheckError
+			if errors.As(err, &chkErr) {
+				printCheckError(os.Stderr, shellFlags.AppendPath, chkErr)
+				return fmt.Errorf("cannot append to %s until it passes", shellFlags.AppendPath)
+			}
+			return err
 		}
-		defer file.Close()
 
-		if err := sh.DumpTranscript(file); err != nil {
+		if err := sh.Save(); err != nil {
 			return fmt.Errorf("writing output: %w", err)
 		}
-		if shellFlags.OutputPath == "" {
-			_, _ = fmt.Printf("wrote transcript: %s\n", file.Name())
+		if outputPath != shellFlags.OutputPath && outputPath != shellFlags.AppendPath {
+			_, _ = fmt.Printf("wrote transcript: %s\n", outputPath)
 		}
 		return nil
 	},
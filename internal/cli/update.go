@@ -1,10 +1,15 @@
 package cli
 
 import (
+	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
 
 	"github.com/deref/transcript/internal/core"
 	"github.com/natefinch/atomic"
@@ -13,47 +18,197 @@ import (
 
 func init() {
 	updateCmd.Flags().BoolVarP(&updateFlags.DryRun, "dry-run", "n", false, "dry run")
+	updateCmd.Flags().BoolVar(&updateFlags.Check, "check", false, "report stale transcripts without writing")
+	updateCmd.Flags().IntSliceVar(&updateFlags.Lines, "line", nil, "only update the commands at these line numbers")
+	updateCmd.Flags().BoolVar(&updateFlags.OnlyFailing, "only-failing", false, "only update commands that fail their checks")
+	updateCmd.Flags().Var(&updateFlags.Externalize, "externalize-over", "write text output over this many lines (or bytes, like 16kb) to a file")
+	addMarkdownSessionFlag(updateCmd)
 	rootCmd.AddCommand(updateCmd)
 }
 
 var updateFlags struct {
-	DryRun bool
+	DryRun      bool
+	Check       bool
+	Lines       []int
+	OnlyFailing bool
+	Externalize core.ExternalizeLimit
 }
 
 var updateCmd = &cobra.Command{
-	Use:   "update <transcripts...>",
+	Use:   "update <transcripts[:line]...>",
 	Short: "Updates transcript files",
 	Long: `Updates output and exit code expectations in transcript files.
-	
+
 Transcript files are updated in-place, unless --dry-run is specified. In a dry
 run, the updated output is printed to stdout instead.
+
+With --check, nothing is written. Instead, a diff is printed for each
+transcript that an update would change, and the command exits non-zero if any
+transcript is stale.
+
+All commands are always executed, but the expectations of individual commands
+can be updated selectively. Use --line (or a file.cmdt:line argument) to update
+only the command at a given line, and --only-failing to update only the
+commands that fail their checks. Every other command's expectations are kept
+exactly as written.
+
+In Markdown files (*.md), only the fenced cmdt code blocks are updated, and
+line numbers refer to lines of the Markdown file.
 `,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		ctx := cmd.Context()
-		for _, filename := range args {
-			if err := updateFile(ctx, filename); err != nil {
-				return fmt.Errorf("updating %q: %w", filename, err)
+		targets := parseUpdateTargets(args)
+		if updateFlags.Check {
+			if updateFlags.DryRun {
+				return errors.New("--check and --dry-run are mutually exclusive")
+			}
+			stale, err := runUpdateCheck(ctx, targets, cmd.OutOrStdout())
+			if err != nil {
+				return err
+			}
+			if stale > 0 {
+				os.Exit(1)
+			}
+			return nil
+		}
+		for _, target := range targets {
+			if err := updateFile(ctx, target); err != nil {
+				return fmt.Errorf("updating %q: %w", target.Filename, err)
 			}
 		}
 		return nil
 	},
 }
 
-func updateFile(ctx context.Context, filename string) error {
-	f, err := os.Open(filename)
+// updateTarget is a transcript to update, along with the lines selected for
+// updating in that transcript.
+type updateTarget struct {
+	Filename string
+	Lines    []int
+}
+
+// parseUpdateTargets interprets arguments of the form file.cmdt or
+// file.cmdt:line, merging multiple lines selected in the same file.
+func parseUpdateTargets(args []string) []updateTarget {
+	var targets []updateTarget
+	indexes := make(map[string]int)
+	for _, arg := range args {
+		filename, lines := arg, updateFlags.Lines
+		if _, err := os.Stat(arg); err != nil {
+			if prefix, suffix, ok := cutLast(arg, ":"); ok {
+				if lineno, err := strconv.Atoi(suffix); err == nil {
+					filename = prefix
+					lines = append(slices.Clone(lines), lineno)
+				}
+			}
+		}
+		if idx, ok := indexes[filename]; ok {
+			targets[idx].Lines = slices.Concat(targets[idx].Lines, lines)
+			continue
+		}
+		indexes[filename] = len(targets)
+		targets = append(targets, updateTarget{
+			Filename: filename,
+			Lines:    lines,
+		})
+	}
+	return targets
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+func newUpdater(target updateTarget) *core.Updater {
+	return &core.Updater{
+		Lines:       target.Lines,
+		OnlyFailing: updateFlags.OnlyFailing,
+		Externalize: updateFlags.Externalize,
+	}
+}
+
+func updateFile(ctx context.Context, target updateTarget) error {
+	filename := target.Filename
+	original, err := os.ReadFile(filename)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	upr := &core.Updater{}
-	transcript, err := upr.UpdateTranscript(ctx, f)
+	updated, err := updateContent(ctx, filename, original, func() *core.Updater {
+		return newUpdater(target)
+	})
 	if err != nil {
 		return err
 	}
 	if updateFlags.DryRun {
-		_, err := io.Copy(os.Stdout, transcript)
+		_, err := os.Stdout.Write(updated)
 		return err
 	}
-	return atomic.WriteFile(filename, transcript)
+	return atomic.WriteFile(filename, bytes.NewReader(updated))
+}
+
+// runUpdateCheck runs the updater over each transcript without writing
+// anything, and reports the transcripts (and referenced files) that an
+// update would change.
+func runUpdateCheck(ctx context.Context, targets []updateTarget, out io.Writer) (stale int, err error) {
+	for _, target := range targets {
+		ok, err := checkUpdateFile(ctx, target, out)
+		if err != nil {
+			return stale, fmt.Errorf("updating %q: %w", target.Filename, err)
+		}
+		if !ok {
+			stale++
+		}
+	}
+	if stale > 0 {
+		fmt.Fprintf(out, "%d of %d transcripts are stale; run transcript update\n", stale, len(targets))
+	}
+	return stale, nil
+}
+
+func checkUpdateFile(ctx context.Context, target updateTarget, out io.Writer) (ok bool, err error) {
+	filename := target.Filename
+	original, err := os.ReadFile(filename)
+	if err != nil {
+		return false, err
+	}
+
+	var staleRefs []string
+	updated, err := updateContent(ctx, filename, original, func() *core.Updater {
+		upr := newUpdater(target)
+		upr.WriteFile = func(ref string, data []byte) error {
+			existing, err := os.ReadFile(ref)
+			if err != nil || !bytes.Equal(existing, data) {
+				staleRefs = append(staleRefs, ref)
+			}
+			return nil
+		}
+		return upr
+	})
+	if err != nil {
+		return false, err
+	}
+
+	ok = true
+	if !bytes.Equal(original, updated) {
+		ok = false
+		fmt.Fprintf(out, "stale transcript: %s\n", filename)
+		diffErr := core.DiffError{
+			Expected: string(original),
+			Actual:   string(updated),
+		}
+		if color {
+			fmt.Fprint(out, diffErr.Color())
+		} else {
+			fmt.Fprint(out, diffErr.Plain())
+		}
+	}
+	for _, ref := range staleRefs {
+		ok = false
+		fmt.Fprintf(out, "stale file: %s (referenced by %s)\n", ref, filename)
+	}
+	return ok, nil
 }
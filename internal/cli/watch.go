@@ -0,0 +1,304 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/deref/transcript/internal/core"
+	"github.com/spf13/cobra"
+)
+
+func init() {
+	watchCmd.Flags().IntVarP(&watchFlags.Jobs, "jobs", "j", 0, "maximum number of transcript files to check in parallel (0 = GOMAXPROCS)")
+	rootCmd.AddCommand(watchCmd)
+}
+
+var watchFlags struct {
+	Jobs int
+}
+
+var watchCmd = &cobra.Command{
+	Use:   "watch <paths...>",
+	Short: "Re-checks transcript files when they change",
+	Long: `Checks transcript files, then re-checks them whenever they change.
+
+Paths may be transcript files or directories to search for *.cmdt files.
+Besides the transcripts themselves, the files they reference with 1< / 2<
+and the files they declare with % dep are watched. When a file changes, only
+the transcripts that depend on it are checked again.
+
+Dependencies that can only be determined by running a transcript (for example,
+% dep paths that use parameter expansion) are not watched.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		if len(args) == 0 {
+			warnf("no transcripts to watch")
+			os.Exit(1)
+		}
+		ws := &watchSession{
+			Paths: args,
+			Out:   cmd.OutOrStdout(),
+			Jobs:  watchFlags.Jobs,
+		}
+		return ws.Run(cmd.Context())
+	},
+}
+
+// watchDebounce is how long to wait for related changes (such as an editor
+// writing several files) before re-checking.
+const watchDebounce = 100 * time.Millisecond
+
+type watchSession struct {
+	Paths []string
+	Out   io.Writer
+	Jobs  int
+
+	watcher     fileWatcher // Defaults to a watcher for the platform.
+	transcripts []string
+	deps        map[string][]string // Absolute dependency paths, by transcript.
+	passed      map[string]bool
+	hashes      map[string][sha256.Size]byte
+}
+
+func (ws *watchSession) Run(ctx context.Context) error {
+	var err error
+	if ws.watcher == nil {
+		ws.watcher, err = newFileWatcher()
+		if err != nil {
+			return fmt.Errorf("watching: %w", err)
+		}
+	}
+	defer ws.watcher.Close()
+
+	ws.deps = make(map[string][]string)
+	ws.passed = make(map[string]bool)
+	ws.hashes = make(map[string][sha256.Size]byte)
+
+	var changed []string
+	for {
+		if err := ws.discover(); err != nil {
+			return err
+		}
+		for _, filename := range ws.transcripts {
+			if _, ok := ws.deps[filename]; !ok && !slices.Contains(changed, filename) {
+				changed = append(changed, filename)
+			}
+		}
+		if len(changed) > 0 {
+			if err := ws.check(ctx, changed); err != nil {
+				return err
+			}
+		}
+
+		changed, err = ws.wait(ctx)
+		if err != nil {
+			return err
+		}
+		if changed == nil {
+			return nil
+		}
+	}
+}
+
+// discover finds the transcripts named by, or beneath, the watched paths.
+func (ws *watchSession) discover() error {
+	ws.transcripts = ws.transcripts[:0]
+	for _, path := range ws.Paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			ws.transcripts = append(ws.transcripts, path)
+			continue
+		}
+		if err := ws.watcher.WatchDir(path); err != nil {
+			return err
+		}
+		err = filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() {
+				return ws.watcher.WatchDir(path)
+			}
+			if strings.HasSuffix(path, ".cmdt") && !slices.Contains(ws.transcripts, path) {
+				ws.transcripts = append(ws.transcripts, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// check runs the given transcripts, then redraws the summary.
+func (ws *watchSession) check(ctx context.Context, filenames []string) error {
+	var out bytes.Buffer
+	_, err := runCheck(ctx, checkOptions{
+		Filenames: filenames,
+		Out:       &out,
+		Jobs:      ws.Jobs,
+		Report: func(filename string, ok bool) {
+			ws.passed[filename] = ok
+		},
+	})
+	if err != nil {
+		fmt.Fprintf(&out, "error: %v\n", err)
+	}
+
+	for _, filename := range filenames {
+		if err := ws.refreshDeps(filename); err != nil {
+			fmt.Fprintf(&out, "error: reading %s: %v\n", filename, err)
+		}
+	}
+
+	if isTTY() {
+		// Clear the screen.
+		io.WriteString(ws.Out, "\x1b[H\x1b[2J")
+	}
+	_, _ = io.Copy(ws.Out, &out)
+	ws.printSummary(len(filenames))
+	return nil
+}
+
+func (ws *watchSession) refreshDeps(filename string) error {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return err
+	}
+	deps := []string{abs}
+	ws.deps[filename] = deps
+
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+	staticDeps, err := core.StaticDeps(cwd, f)
+	if err != nil {
+		return err
+	}
+	deps = append(deps, staticDeps...)
+	ws.deps[filename] = deps
+
+	for _, dep := range deps {
+		if err := ws.watcher.WatchFile(dep); err != nil {
+			return err
+		}
+		ws.hashes[dep] = hashFile(dep)
+	}
+	return nil
+}
+
+func (ws *watchSession) printSummary(checked int) {
+	passed, failed := 0, 0
+	for _, filename := range ws.transcripts {
+		ok, found := ws.passed[filename]
+		switch {
+		case !found:
+		case ok:
+			passed++
+		default:
+			failed++
+			fmt.Fprintf(ws.Out, "FAIL %s\n", filename)
+		}
+	}
+	fmt.Fprintf(ws.Out, "%d passed, %d failed; checked %d at %s. Watching for changes...\n",
+		passed, failed, checked, time.Now().Format(time.TimeOnly))
+}
+
+// wait blocks until watched files change, and returns the transcripts that
+// depend on them. Returns nil if the context is done.
+func (ws *watchSession) wait(ctx context.Context) ([]string, error) {
+	for {
+		var paths []string
+		select {
+		case <-ctx.Done():
+			return nil, nil
+		case path, ok := <-ws.watcher.Events():
+			if !ok {
+				return nil, errors.New("watcher stopped")
+			}
+			paths = append(paths, path)
+		}
+		timer := time.NewTimer(watchDebounce)
+	debounce:
+		for {
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, nil
+			case path, ok := <-ws.watcher.Events():
+				if !ok {
+					timer.Stop()
+					return nil, errors.New("watcher stopped")
+				}
+				paths = append(paths, path)
+			case <-timer.C:
+				break debounce
+			}
+		}
+
+		// Ignore events that didn't change file contents, such as those caused
+		// by checking itself.
+		var modified []string
+		for _, path := range paths {
+			hash := hashFile(path)
+			if prev, ok := ws.hashes[path]; !ok || prev != hash {
+				ws.hashes[path] = hash
+				modified = append(modified, path)
+			}
+		}
+
+		var affected []string
+		if err := ws.discover(); err != nil {
+			return nil, err
+		}
+		for _, filename := range ws.transcripts {
+			deps, ok := ws.deps[filename]
+			if !ok || slices.ContainsFunc(deps, func(dep string) bool {
+				return slices.Contains(modified, dep)
+			}) {
+				affected = append(affected, filename)
+			}
+		}
+		if len(affected) > 0 {
+			return affected, nil
+		}
+	}
+}
+
+// hashFile returns a hash of the file's contents, or the zero hash if it
+// cannot be read.
+func hashFile(path string) (hash [sha256.Size]byte) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return hash
+	}
+	return sha256.Sum256(data)
+}
+
+// fileWatcher reports changes to files. Events are absolute paths of watched
+// files, or of any file in a watched directory.
+type fileWatcher interface {
+	WatchFile(path string) error
+	WatchDir(path string) error
+	Events() <-chan string
+	Close() error
+}
@@ -0,0 +1,131 @@
+package cli
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// inotifyWatcher watches the parent directories of watched files, since
+// editors commonly replace files rather than writing them in place.
+type inotifyWatcher struct {
+	// The raw fd is kept for adding watches, since calling file.Fd() would
+	// put it in blocking mode, and Close could no longer interrupt reads.
+	fd      int
+	file    *os.File
+	events  chan string
+	done    chan struct{}
+	closing sync.Once
+
+	mu    sync.Mutex
+	dirs  map[int]string  // Directory paths, by watch descriptor.
+	wds   map[string]int  // Watch descriptors, by directory path.
+	files map[string]bool // Watched file paths.
+	all   map[string]bool // Directories whose every file is watched.
+}
+
+func newFileWatcher() (fileWatcher, error) {
+	fd, err := unix.InotifyInit1(unix.IN_CLOEXEC | unix.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify_init1: %w", err)
+	}
+	w := &inotifyWatcher{
+		fd:     fd,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan string),
+		done:   make(chan struct{}),
+		dirs:   make(map[int]string),
+		wds:    make(map[string]int),
+		files:  make(map[string]bool),
+		all:    make(map[string]bool),
+	}
+	go w.readEvents()
+	return w, nil
+}
+
+func (w *inotifyWatcher) WatchFile(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.files[path] = true
+	w.mu.Unlock()
+	return w.addDir(filepath.Dir(path))
+}
+
+func (w *inotifyWatcher) WatchDir(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	w.all[path] = true
+	w.mu.Unlock()
+	return w.addDir(path)
+}
+
+func (w *inotifyWatcher) addDir(dir string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.wds[dir]; ok {
+		return nil
+	}
+	const mask = unix.IN_CLOSE_WRITE | unix.IN_CREATE | unix.IN_DELETE | unix.IN_MOVED_FROM | unix.IN_MOVED_TO
+	wd, err := unix.InotifyAddWatch(w.fd, dir, mask)
+	if err != nil {
+		// The directory may not exist yet, for example if a dependency is
+		// missing. There is nothing to watch until a transcript re-runs.
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("watching %s: %w", dir, err)
+	}
+	w.dirs[wd] = dir
+	w.wds[dir] = wd
+	return nil
+}
+
+func (w *inotifyWatcher) readEvents() {
+	defer close(w.events)
+	buf := make([]byte, 64*1024)
+	for {
+		n, err := w.file.Read(buf)
+		if err != nil {
+			return
+		}
+		for offset := 0; offset+unix.SizeofInotifyEvent <= n; {
+			event := (*unix.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + unix.SizeofInotifyEvent
+			name := string(bytes.TrimRight(buf[nameStart:nameStart+int(event.Len)], "\x00"))
+			offset = nameStart + int(event.Len)
+
+			w.mu.Lock()
+			dir := w.dirs[int(event.Wd)]
+			path := filepath.Join(dir, name)
+			watched := w.files[path] || w.all[dir]
+			w.mu.Unlock()
+			if watched && name != "" {
+				select {
+				case w.events <- path:
+				case <-w.done:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (w *inotifyWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *inotifyWatcher) Close() error {
+	w.closing.Do(func() { close(w.done) })
+	return w.file.Close()
+}
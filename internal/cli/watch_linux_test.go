@@ -0,0 +1,34 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestInotifyWatcher_Close(t *testing.T) {
+	for _, pending := range []bool{false, true} {
+		dir := t.TempDir()
+		w, err := newFileWatcher()
+		require.NoError(t, err)
+		require.NoError(t, w.WatchDir(dir))
+		if pending {
+			// Leave an event that nobody receives.
+			require.NoError(t, os.WriteFile(filepath.Join(dir, "a.cmdt"), nil, 0600))
+		}
+		time.Sleep(50 * time.Millisecond)
+
+		// Closing stops reading, whether blocked reading or sending.
+		require.NoError(t, w.Close())
+		time.Sleep(50 * time.Millisecond)
+		select {
+		case _, ok := <-w.Events():
+			require.False(t, ok, "pending=%v", pending)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("events were not closed (pending=%v)", pending)
+		}
+	}
+}
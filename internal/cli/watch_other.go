@@ -0,0 +1,125 @@
+//go:build !linux
+
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+// pollWatcher is a portable fileWatcher that periodically compares the
+// modification times of watched files.
+type pollWatcher struct {
+	events chan string
+	done   chan struct{}
+
+	mu      sync.Mutex
+	files   map[string]time.Time
+	dirs    map[string]bool
+	closing sync.Once
+}
+
+const pollInterval = 500 * time.Millisecond
+
+func newFileWatcher() (fileWatcher, error) {
+	w := &pollWatcher{
+		events: make(chan string),
+		done:   make(chan struct{}),
+		files:  make(map[string]time.Time),
+		dirs:   make(map[string]bool),
+	}
+	go w.poll()
+	return w, nil
+}
+
+func (w *pollWatcher) WatchFile(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if _, ok := w.files[path]; !ok {
+		w.files[path] = modTime(path)
+	}
+	return nil
+}
+
+func (w *pollWatcher) WatchDir(path string) error {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.dirs[path] = true
+	w.scanDir(path, false)
+	return nil
+}
+
+// scanDir starts watching new files in dir, reporting them if notify is set.
+// Must be called with mu held.
+func (w *pollWatcher) scanDir(dir string, notify bool) []string {
+	var added []string
+	entries, _ := os.ReadDir(dir)
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if _, ok := w.files[path]; !ok && !entry.IsDir() {
+			w.files[path] = modTime(path)
+			if notify {
+				added = append(added, path)
+			}
+		}
+	}
+	return added
+}
+
+func (w *pollWatcher) poll() {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+		}
+		var changed []string
+		w.mu.Lock()
+		for path, prev := range w.files {
+			if mtime := modTime(path); !mtime.Equal(prev) {
+				w.files[path] = mtime
+				changed = append(changed, path)
+			}
+		}
+		for dir := range w.dirs {
+			changed = append(changed, w.scanDir(dir, true)...)
+		}
+		w.mu.Unlock()
+		for _, path := range changed {
+			select {
+			case w.events <- path:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+func modTime(path string) time.Time {
+	info, err := os.Stat(path)
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+func (w *pollWatcher) Events() <-chan string {
+	return w.events
+}
+
+func (w *pollWatcher) Close() error {
+	w.closing.Do(func() { close(w.done) })
+	return nil
+}
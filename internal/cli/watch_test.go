@@ -0,0 +1,143 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a bytes.Buffer that can be written by a watch session while
+// a test reads it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// fakeWatcher is a fileWatcher whose events are sent by the test.
+type fakeWatcher struct {
+	events chan string
+}
+
+func (w *fakeWatcher) WatchFile(path string) error { return nil }
+func (w *fakeWatcher) WatchDir(path string) error  { return nil }
+func (w *fakeWatcher) Events() <-chan string       { return w.events }
+func (w *fakeWatcher) Close() error                { return nil }
+
+// startWatch runs a watch session on the given paths until the test ends.
+func startWatch(t *testing.T, ws *watchSession) (out *syncBuffer, done <-chan error) {
+	t.Helper()
+	out = &syncBuffer{}
+	ws.Out = out
+	ctx, cancel := context.WithCancel(context.Background())
+	errc := make(chan error, 1)
+	go func() {
+		errc <- ws.Run(ctx)
+		close(errc)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-errc
+	})
+	return out, errc
+}
+
+func waitForOutput(t *testing.T, out *syncBuffer, substr string) {
+	t.Helper()
+	require.Eventually(t, func() bool {
+		return strings.Contains(out.String(), substr)
+	}, 5*time.Second, 10*time.Millisecond, "waiting for %q in output:\n%s", substr, out)
+}
+
+func TestWatch_RerunsOnChange(t *testing.T) {
+	tmp := t.TempDir()
+	orig, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tmp))
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+
+	require.NoError(t, os.WriteFile("a.cmdt", []byte("$ echo hi\n1 hi\n"), 0600))
+
+	out, _ := startWatch(t, &watchSession{Paths: []string{"."}})
+	waitForOutput(t, out, "1 passed, 0 failed; checked 1")
+
+	require.NoError(t, os.WriteFile("a.cmdt", []byte("$ echo hi\n1 bye\n"), 0600))
+	waitForOutput(t, out, "0 passed, 1 failed; checked 1")
+	require.Contains(t, out.String(), "FAIL a.cmdt")
+}
+
+func TestWatch_Debounce(t *testing.T) {
+	tmp := t.TempDir()
+	orig, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tmp))
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+
+	require.NoError(t, os.WriteFile("a.cmdt", []byte("$ echo hi\n1 hi\n"), 0600))
+	path, err := filepath.Abs("a.cmdt")
+	require.NoError(t, err)
+
+	watcher := &fakeWatcher{events: make(chan string)}
+	out, _ := startWatch(t, &watchSession{Paths: []string{"a.cmdt"}, watcher: watcher})
+	waitForOutput(t, out, "Watching for changes")
+
+	// A burst of changes is checked once.
+	for _, transcript := range []string{
+		"$ echo hi\n1 a\n",
+		"$ echo hi\n1 b\n",
+		"$ echo hey\n1 hey\n",
+	} {
+		require.NoError(t, os.WriteFile("a.cmdt", []byte(transcript), 0600))
+		watcher.events <- path
+	}
+	require.Eventually(t, func() bool {
+		return strings.Count(out.String(), "Watching for changes") >= 2
+	}, 5*time.Second, 10*time.Millisecond)
+	time.Sleep(2 * watchDebounce)
+	require.Equal(t, 2, strings.Count(out.String(), "Watching for changes"), out.String())
+	require.NotContains(t, out.String(), "FAIL")
+}
+
+func TestWatch_StopsWhenWatcherStops(t *testing.T) {
+	tmp := t.TempDir()
+	orig, err := os.Getwd()
+	require.NoError(t, err)
+	require.NoError(t, os.Chdir(tmp))
+	t.Cleanup(func() { _ = os.Chdir(orig) })
+
+	require.NoError(t, os.WriteFile("a.cmdt", []byte("$ echo hi\n1 hi\n"), 0600))
+	path, err := filepath.Abs("a.cmdt")
+	require.NoError(t, err)
+
+	watcher := &fakeWatcher{events: make(chan string)}
+	out, done := startWatch(t, &watchSession{Paths: []string{"a.cmdt"}, watcher: watcher})
+	waitForOutput(t, out, "Watching for changes")
+
+	// Stop while debouncing.
+	watcher.events <- path
+	close(watcher.events)
+	select {
+	case err := <-done:
+		require.EqualError(t, err, "watcher stopped")
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch did not stop")
+	}
+}
@@ -11,18 +11,56 @@ import (
 )
 
 type Checker struct {
+	// If provided, commands are run by this initialized recorder rather than a
+	// new one, so that the shell state left behind by the transcript (working
+	// directory, variables, functions) can be used afterwards.
+	Recorder *Recorder
+	// If provided, notified as each command is run and checked.
+	Observer Observer
+
+	keepGoing        bool // Whether to continue after failed commands.
+	results          []*CheckResult
 	rec              *Recorder
 	interpreter      *Interpreter
 	expectedOutput   bytes.Buffer
 	expectedExitCode int
 	actualResult     *CommandResult
+
+	// Binary files referenced by the current command's expectations and
+	// written by the command itself, which are matched by content.
+	expectedFiles map[int]expectedFile
+	writtenFiles  map[string][]byte
+}
+
+type expectedFile struct {
+	filepath string
+	data     []byte
 }
 
 func (ckr *Checker) CheckTranscript(ctx context.Context, r io.Reader) error {
-	ckr.rec = &Recorder{}
-	if err := ckr.rec.Init(); err != nil {
-		return fmt.Errorf("initializing recorder: %w", err)
+	ckr.rec = ckr.Recorder
+	if ckr.rec == nil {
+		ckr.rec = &Recorder{}
+		if err := ckr.rec.Init(); err != nil {
+			return fmt.Errorf("initializing recorder: %w", err)
+		}
+	}
+
+	// Capture the files written by commands to compare them with the files
+	// their expectations reference, which must not be overwritten.
+	writeFile := ckr.rec.WriteFile
+	ckr.rec.WriteFile = func(filename string, data []byte) error {
+		ckr.writtenFiles[filename] = bytes.Clone(data)
+		if writeFile != nil {
+			return writeFile(filename, data)
+		}
+		return nil
 	}
+	defer func() {
+		ckr.rec.WriteFile = writeFile
+	}()
+	ckr.expectedFiles = make(map[int]expectedFile)
+	ckr.writtenFiles = make(map[string][]byte)
 
 	ckr.interpreter = &Interpreter{
 		Handler: &checkHandler{
@@ -33,6 +71,21 @@ func (ckr *Checker) CheckTranscript(ctx context.Context, r io.Reader) error {
 	return ckr.interpreter.ExecTranscript(ctx, r)
 }
 
+// CheckTranscriptResults checks every command of a transcript, continuing
+// after commands that fail, and returns the result of each. The returned
+// error reports problems that prevent checking, such as syntax errors or
+// commands that could not be run, in which case the results of the commands
+// checked so far are returned along with it.
+func (ckr *Checker) CheckTranscriptResults(ctx context.Context, r io.Reader) ([]*CheckResult, error) {
+	ckr.keepGoing = true
+	ckr.results = nil
+	defer func() {
+		ckr.keepGoing = false
+	}()
+	err := ckr.CheckTranscript(ctx, r)
+	return ckr.results, err
+}
+
 type checkHandler struct {
 	*Checker
 }
@@ -42,9 +95,18 @@ func (ckr *checkHandler) HandleComment(ctx context.Context, text string) error {
 }
 
 func (ckr *checkHandler) HandleRun(ctx context.Context, command string) error {
+	if ckr.Observer != nil {
+		ckr.Observer.CommandStarted(ctx, ckr.interpreter.CommandLineno, command)
+	}
 	var err error
 	ckr.actualResult, err = ckr.rec.RunCommand(ctx, command)
 	if err != nil {
+		ckr.report(ctx, &CheckResult{
+			Lineno:  ckr.interpreter.CommandLineno,
+			Command: command,
+			Status:  CheckFailed,
+			Errs:    []error{err},
+		})
 		return ckr.commandCheckError(err)
 	}
 	return nil
@@ -59,16 +121,31 @@ func (ckr *checkHandler) HandleOutput(ctx context.Context, fd int, line string)
 }
 
 func (ckr *checkHandler) HandleFileOutput(ctx context.Context, fd int, filepath string) error {
+	expected, data, err := expectedFileOutput(ckr.rec, fd, filepath)
+	if err != nil {
+		return err
+	}
+	if data != nil {
+		ckr.expectedFiles[fd] = expectedFile{filepath, data}
+	}
+	_, err = io.WriteString(&ckr.expectedOutput, expected)
+	return err
+}
+
+// expectedFileOutput returns the output that a command would have to record
+// in order to match a `1<` or `2<` file reference, along with the content of
+// the file if it is binary.
+func expectedFileOutput(rec *Recorder, fd int, filepath string) (string, []byte, error) {
 	displayPath := filepath
 	readPath := filepath
-	if ckr.rec.runner != nil && readPath != "" && !filepathpkg.IsAbs(readPath) {
-		readPath = filepathpkg.Join(ckr.rec.runner.Dir, readPath)
+	if rec.runner != nil && readPath != "" && !filepathpkg.IsAbs(readPath) {
+		readPath = filepathpkg.Join(rec.runner.Dir, readPath)
 	}
 
 	// Read the expected file content.
 	expectedData, err := os.ReadFile(readPath)
 	if err != nil {
-		return fmt.Errorf("reading expected file %s: %w", readPath, err)
+		return "", nil, fmt.Errorf("reading expected file %s: %w", readPath, err)
 	}
 
 	// Build the expected output string that would be generated if this was inline.
@@ -76,8 +153,7 @@ func (ckr *checkHandler) HandleFileOutput(ctx context.Context, fd int, filepath
 		// For binary files, we expect the file reference format.
 		// Keep the cmdt filepath string exactly as-written (relative paths are
 		// meaningful to users, even if we resolve them for reading).
-		expectedOutput := fmt.Sprintf("%d< %s", fd, displayPath)
-		return ckr.expectOutput(expectedOutput)
+		return fmt.Sprintf("%d< %s\n", fd, displayPath), expectedData, nil
 	} else {
 		// For text files, we expect the inline format.
 		var builder strings.Builder
@@ -92,10 +168,8 @@ func (ckr *checkHandler) HandleFileOutput(ctx context.Context, fd int, filepath
 		if len(expectedData) > 0 && expectedData[len(expectedData)-1] != '\n' {
 			builder.WriteString("\n% no-newline\n")
 		}
-		// builder already includes cmdt line terminators (the original output newlines),
-		// so write it directly to avoid adding an extra newline.
-		_, err := io.WriteString(&ckr.expectedOutput, builder.String())
-		return err
+		// builder already includes cmdt line terminators (the original output newlines).
+		return builder.String(), nil, nil
 	}
 }
 
@@ -116,6 +190,29 @@ func (ckr *checkHandler) HandleDep(ctx context.Context, payload string) error {
 	return nil
 }
 
+func (ckr *checkHandler) HandleExternalize(ctx context.Context, limit ExternalizeLimit) error {
+	// Externalized output is checked the same as inline output.
+	return nil
+}
+
+func (ckr *checkHandler) HandleFile(ctx context.Context, path string, content []byte) error {
+	if err := ckr.rec.WriteFixture(path, content); err != nil {
+		return fmt.Errorf("writing file %q: %w", path, err)
+	}
+	return nil
+}
+
+func (ckr *checkHandler) HandleDirective(ctx context.Context, name string, args string) error {
+	ok, err := ckr.rec.runDirective(ctx, name, args, ckr.interpreter.Lineno)
+	if !ok {
+		return ckr.syntaxErrorf("invalid directive: %q", name)
+	}
+	if err != nil {
+		return fmt.Errorf("error on line %d: %s: %w", ckr.interpreter.Lineno, name, err)
+	}
+	return nil
+}
+
 func (ckr *checkHandler) HandleExitCode(ctx context.Context, exitCode int) error {
 	ckr.expectedExitCode = exitCode
 	return nil
@@ -126,31 +223,57 @@ func (ckr *Checker) HandleEnd(ctx context.Context) error {
 		ckr.actualResult = nil
 		ckr.expectedOutput.Reset()
 		ckr.expectedExitCode = 0
+		clear(ckr.expectedFiles)
+		clear(ckr.writtenFiles)
 	}()
 
-	var errs []error
-
-	expectedOutput := ckr.expectedOutput.String()
-	actualOutput := string(ckr.actualResult.Output)
-	if expectedOutput != actualOutput {
-		//fmt.Printf("expected: %q\nactual: %q\n", expectedOutput, actualOutput)
-		errs = append(errs, DiffError{
-			Expected: expectedOutput,
-			Actual:   actualOutput,
-		})
+	result := newCheckResult(
+		ckr.interpreter.CommandLineno,
+		ckr.interpreter.Command,
+		ckr.expectedOutput.String(),
+		ckr.expectedExitCode,
+		ckr.actualResult,
+		ckr.matchFiles(string(ckr.actualResult.Output)),
+	)
+	ckr.report(ctx, result)
+	if result.Status == CheckFailed && !ckr.keepGoing {
+		return ckr.commandCheckError(result.Errs...)
 	}
+	return nil
+}
 
-	if ckr.expectedExitCode != ckr.actualResult.ExitCode {
-		errs = append(errs,
-			fmt.Errorf("expected exit code %d, but got %d",
-				ckr.expectedExitCode,
-				ckr.actualResult.ExitCode))
+// matchFiles replaces the names of binary files written by the current
+// command with the names of the expected files that have the same content,
+// since newly written files are named independently of the transcript.
+func (ckr *Checker) matchFiles(output string) string {
+	if len(ckr.writtenFiles) == 0 {
+		return output
+	}
+	var builder strings.Builder
+	for line := range strings.Lines(output) {
+		for fd, expected := range ckr.expectedFiles {
+			name, ok := strings.CutPrefix(line, fmt.Sprintf("%d< ", fd))
+			if !ok {
+				continue
+			}
+			data, ok := ckr.writtenFiles[strings.TrimSuffix(name, "\n")]
+			if ok && bytes.Equal(data, expected.data) {
+				line = fmt.Sprintf("%d< %s\n", fd, expected.filepath)
+			}
+		}
+		builder.WriteString(line)
 	}
+	return builder.String()
+}
 
-	if len(errs) > 0 {
-		return ckr.commandCheckError(errs...)
+// report records the result of a command and notifies the Observer.
+func (ckr *Checker) report(ctx context.Context, result *CheckResult) {
+	if ckr.keepGoing {
+		ckr.results = append(ckr.results, result)
+	}
+	if ckr.Observer != nil {
+		ckr.Observer.CommandChecked(ctx, result)
 	}
-	return nil
 }
 
 func (ckr *Checker) expectOutput(text string) error {
@@ -159,7 +282,7 @@ func (ckr *Checker) expectOutput(text string) error {
 }
 
 func (ckr *Checker) syntaxErrorf(message string, v ...any) error {
-	return fmt.Errorf("syntax error on line %d: "+message, append([]any{ckr.interpreter.Lineno}, v...))
+	return fmt.Errorf("syntax error on line %d: "+message, append([]any{ckr.interpreter.Lineno}, v...)...)
 }
 
 func (ckr *Checker) commandCheckError(errs ...error) CommandCheckError {
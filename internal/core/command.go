@@ -0,0 +1,38 @@
+package core
+
+import (
+	"context"
+	"io"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// CommandFunc implements a command in Go, in the process running the
+// transcript. It is called with the command's arguments, including the
+// command name as args[0], and its standard streams, and returns the
+// command's exit code, which ranges from 0 to 255. Codes outside that range
+// are reported as 255, so that they still indicate failure.
+type CommandFunc func(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int
+
+// runCommandFunc runs fn as the command being executed by the shell.
+func runCommandFunc(ctx context.Context, fn CommandFunc, args []string) error {
+	hc := interp.HandlerCtx(ctx)
+	stdin := hc.Stdin
+	if stdin == nil {
+		stdin = eofReader{}
+	}
+	code := fn(ctx, args, stdin, orDiscard(hc.Stdout), orDiscard(hc.Stderr))
+	if code < 0 || code > 255 {
+		code = 255
+	}
+	if code != 0 {
+		return interp.NewExitStatus(uint8(code))
+	}
+	return nil
+}
+
+type eofReader struct{}
+
+func (eofReader) Read(p []byte) (int, error) {
+	return 0, io.EOF
+}
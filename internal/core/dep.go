@@ -97,6 +97,17 @@ func runDepIntrinsic(ctx context.Context, args []string) error {
 	return nil
 }
 
+// DeclareDeps declares dependencies of the test process, given like the
+// arguments of a `% dep` directive. Relative paths are resolved against dir.
+func DeclareDeps(dir string, args ...string) error {
+	for _, arg := range args {
+		if err := recordDepArg(dir, arg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func recordDepArg(dir, raw string) error {
 	if raw == "" {
 		return nil
@@ -118,6 +129,18 @@ func recordDepArg(dir, raw string) error {
 }
 
 func recordDepfile(dir string, r io.Reader) error {
+	return scanDepfile(r, func(dep string, env bool) {
+		if env {
+			_, _ = os.LookupEnv(dep)
+		} else {
+			depStat(dir, dep)
+		}
+	})
+}
+
+// scanDepfile calls fn for each dependency in a depfile. The env flag is set
+// for environment variable dependencies, otherwise dep is a file path.
+func scanDepfile(r io.Reader, fn func(dep string, env bool)) error {
 	scanner := bufio.NewScanner(r)
 	for scanner.Scan() {
 		line := strings.TrimSuffix(scanner.Text(), "\r")
@@ -132,9 +155,9 @@ func recordDepfile(dir string, r io.Reader) error {
 			if name == "" {
 				return fmt.Errorf("invalid depfile env var line: %q", line)
 			}
-			_, _ = os.LookupEnv(name)
+			fn(name, true)
 		default:
-			depStat(dir, depUnescape(line))
+			fn(depUnescape(line), false)
 		}
 	}
 	if err := scanner.Err(); err != nil {
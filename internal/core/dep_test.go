@@ -2,6 +2,8 @@ package core
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -100,3 +102,34 @@ func TestRunDepDirective_RejectsMultipleStatements(t *testing.T) {
 		t.Fatalf("expected error")
 	}
 }
+
+func TestStaticDeps(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "deps.txt"), []byte("# comment\n$HOME\nfrom-depfile\n"), 0o644); err != nil {
+		t.Fatalf("write depfile: %v", err)
+	}
+	cmdt := strings.Join([]string{
+		`% dep config.json "quoted path" '$PATH' "$DYNAMIC"`,
+		`% dep < deps.txt`,
+		`$ cat config.json`,
+		`1< expected.txt`,
+		`2< /abs/stderr.bin`,
+		``,
+	}, "\n")
+
+	deps, err := StaticDeps(dir, strings.NewReader(cmdt))
+	if err != nil {
+		t.Fatalf("StaticDeps: %v", err)
+	}
+	want := []string{
+		filepath.Join(dir, "config.json"),
+		filepath.Join(dir, "quoted path"),
+		filepath.Join(dir, "deps.txt"),
+		filepath.Join(dir, "from-depfile"),
+		filepath.Join(dir, "expected.txt"),
+		"/abs/stderr.bin",
+	}
+	if strings.Join(deps, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("StaticDeps() = %q, want %q", deps, want)
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+
+	"mvdan.cc/sh/v3/interp"
+)
+
+// DirectiveFunc implements a custom `% name args` directive.
+type DirectiveFunc func(ctx context.Context, d *Directive) error
+
+// Directive is an occurrence of a custom directive in a transcript.
+type Directive struct {
+	Name   string
+	Args   string // The rest of the line, unparsed.
+	Lineno int
+
+	rec *Recorder
+}
+
+// Runner returns the shell running the transcript's session.
+func (d *Directive) Runner() *interp.Runner {
+	return d.rec.runner
+}
+
+// Dir returns the current working directory of the session.
+func (d *Directive) Dir() string {
+	return d.rec.runner.Dir
+}
+
+// AfterNextCommand arranges for fn to be called with the result of the next
+// command the session runs. An error returned by fn fails that command.
+func (d *Directive) AfterNextCommand(fn func(res *CommandResult) error) {
+	d.rec.afterNext = append(d.rec.afterNext, fn)
+}
+
+// runDirective runs the custom directive name, reporting whether one is
+// registered.
+func (rec *Recorder) runDirective(ctx context.Context, name, args string, lineno int) (ok bool, err error) {
+	fn, ok := rec.Directives[name]
+	if !ok {
+		return false, nil
+	}
+	return true, fn(ctx, &Directive{
+		Name:   name,
+		Args:   args,
+		Lineno: lineno,
+		rec:    rec,
+	})
+}
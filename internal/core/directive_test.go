@@ -0,0 +1,64 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCustomDirectives(t *testing.T) {
+	var dirs []string
+	directives := map[string]DirectiveFunc{
+		"pwd": func(ctx context.Context, d *Directive) error {
+			dirs = append(dirs, d.Dir())
+			return nil
+		},
+		"quiet": func(ctx context.Context, d *Directive) error {
+			d.AfterNextCommand(func(res *CommandResult) error {
+				if len(res.Output) > 0 {
+					return errors.New("expected no output")
+				}
+				return nil
+			})
+			return nil
+		},
+	}
+	newChecker := func() *Checker {
+		rec := &Recorder{Directives: directives}
+		if err := rec.Init(); err != nil {
+			t.Fatal(err)
+		}
+		return &Checker{Recorder: rec}
+	}
+
+	dirs = nil
+	err := newChecker().CheckTranscript(context.Background(), strings.NewReader(`$ cd /
+% pwd
+% quiet
+$ true
+`))
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/"}, dirs)
+
+	err = newChecker().CheckTranscript(context.Background(), strings.NewReader(`% quiet
+$ echo hi
+1 hi
+`))
+	var chkErr CommandCheckError
+	if assert.ErrorAs(t, err, &chkErr) {
+		assert.Equal(t, 2, chkErr.Lineno)
+		assert.EqualError(t, errors.Join(chkErr.Errs...), "expected no output")
+	}
+
+	err = newChecker().CheckTranscript(context.Background(), strings.NewReader("% loud\n"))
+	assert.EqualError(t, err, `syntax error on line 1: invalid directive: "loud"`)
+
+	upr := &Updater{Directives: directives}
+	updated, err := upr.UpdateTranscript(context.Background(), strings.NewReader("% quiet\n$ true\n1 stale\n"))
+	if assert.NoError(t, err) {
+		assert.Equal(t, "% quiet\n$ true\n", updated.String())
+	}
+}
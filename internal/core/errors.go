@@ -2,6 +2,7 @@ package core
 
 import (
 	"bytes"
+	"fmt"
 	"io"
 	"strings"
 
@@ -19,6 +20,17 @@ func (err CommandCheckError) Error() string {
 	return "command checks failed"
 }
 
+// ScriptExitError reports that a recorded script stopped before its end
+// because a command failed while `set -e` was in effect.
+type ScriptExitError struct {
+	Lineno   int
+	ExitCode int
+}
+
+func (err ScriptExitError) Error() string {
+	return fmt.Sprintf("line %d: script exited with status %d", err.Lineno, err.ExitCode)
+}
+
 type DiffError struct {
 	Expected string
 	Actual   string
@@ -0,0 +1,88 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ExternalizeLimit is a size beyond which recorded text output is written to
+// a file and referenced with `1<` / `2<`, rather than inlined. Zero fields
+// impose no limit.
+type ExternalizeLimit struct {
+	Lines int
+	Bytes int
+}
+
+// ParseExternalizeLimit parses a limit such as "200" (lines), "4096b" or
+// "16kb" (bytes). The value "off" disables externalization.
+func ParseExternalizeLimit(s string) (ExternalizeLimit, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "off" {
+		return ExternalizeLimit{}, nil
+	}
+	raw := s
+	unit := 0
+	for _, u := range []struct {
+		suffix string
+		size   int
+	}{
+		{"kb", 1024},
+		{"mb", 1024 * 1024},
+		{"b", 1},
+	} {
+		if digits, ok := strings.CutSuffix(s, u.suffix); ok {
+			s, unit = digits, u.size
+			break
+		}
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n <= 0 {
+		return ExternalizeLimit{}, fmt.Errorf("invalid limit %q: expected a number of lines (like 200), bytes (like 16kb), or off", raw)
+	}
+	if unit == 0 {
+		return ExternalizeLimit{Lines: n}, nil
+	}
+	return ExternalizeLimit{Bytes: n * unit}, nil
+}
+
+// Exceeded reports whether data is over the limit.
+func (lim ExternalizeLimit) Exceeded(data []byte) bool {
+	if lim.Bytes > 0 && len(data) > lim.Bytes {
+		return true
+	}
+	if lim.Lines > 0 {
+		lines := bytes.Count(data, []byte{'\n'})
+		if len(data) > 0 && data[len(data)-1] != '\n' {
+			lines++
+		}
+		return lines > lim.Lines
+	}
+	return false
+}
+
+func (lim ExternalizeLimit) String() string {
+	switch {
+	case lim.Bytes > 0:
+		return fmt.Sprintf("%db", lim.Bytes)
+	case lim.Lines > 0:
+		return strconv.Itoa(lim.Lines)
+	default:
+		return "off"
+	}
+}
+
+// Set implements pflag.Value, so limits can be used as command-line flags.
+func (lim *ExternalizeLimit) Set(s string) error {
+	parsed, err := ParseExternalizeLimit(s)
+	if err != nil {
+		return err
+	}
+	*lim = parsed
+	return nil
+}
+
+func (lim *ExternalizeLimit) Type() string {
+	return "limit"
+}
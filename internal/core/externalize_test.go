@@ -0,0 +1,57 @@
+package core
+
+import "testing"
+
+func TestParseExternalizeLimit(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		in   string
+		want ExternalizeLimit
+	}{
+		{in: `200`, want: ExternalizeLimit{Lines: 200}},
+		{in: `100b`, want: ExternalizeLimit{Bytes: 100}},
+		{in: `16KB`, want: ExternalizeLimit{Bytes: 16 * 1024}},
+		{in: `1mb`, want: ExternalizeLimit{Bytes: 1024 * 1024}},
+		{in: `off`, want: ExternalizeLimit{}},
+	}
+	for _, tc := range cases {
+		got, err := ParseExternalizeLimit(tc.in)
+		if err != nil {
+			t.Fatalf("ParseExternalizeLimit(%q): %v", tc.in, err)
+		}
+		if got != tc.want {
+			t.Fatalf("ParseExternalizeLimit(%q) = %+v, want %+v", tc.in, got, tc.want)
+		}
+	}
+
+	for _, in := range []string{``, `0`, `-1`, `kb`, `10 lines`, `5bk`} {
+		if _, err := ParseExternalizeLimit(in); err == nil {
+			t.Fatalf("ParseExternalizeLimit(%q): expected error", in)
+		}
+	}
+}
+
+func TestExternalizeLimitExceeded(t *testing.T) {
+	t.Parallel()
+
+	lines := ExternalizeLimit{Lines: 2}
+	if lines.Exceeded([]byte("a\nb\n")) {
+		t.Fatalf("2 lines should not exceed a 2 line limit")
+	}
+	if !lines.Exceeded([]byte("a\nb\nc")) {
+		t.Fatalf("3 lines without a trailing newline should exceed a 2 line limit")
+	}
+
+	bytes := ExternalizeLimit{Bytes: 4}
+	if bytes.Exceeded([]byte("abcd")) {
+		t.Fatalf("4 bytes should not exceed a 4 byte limit")
+	}
+	if !bytes.Exceeded([]byte("abcde")) {
+		t.Fatalf("5 bytes should exceed a 4 byte limit")
+	}
+
+	if (ExternalizeLimit{}).Exceeded(make([]byte, 1<<20)) {
+		t.Fatalf("zero limit should never be exceeded")
+	}
+}
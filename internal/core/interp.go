@@ -2,6 +2,7 @@ package core
 
 import (
 	"bufio"
+	"bytes"
 	"context"
 	"fmt"
 	"io"
@@ -15,16 +16,23 @@ type Interpreter struct {
 	Handler Handler
 
 	// Exposed state.
-	Lineno        int    // Line currently executing.
-	Command       string // Text of the most recently executed command.
-	CommandLineno int    // Line of the most recently executed command.
+	Lineno        int      // Line currently executing.
+	Line          string   // Text of the line currently executing.
+	Command       string   // Text of the most recently executed command.
+	CommandLineno int      // Line of the most recently executed command.
+	FileLines     []string // Lines of the most recent `% file` directive, as written.
 
 	// Private state.
 	acceptResults bool
 	prevFD        int // stdout (1), stderr (2) or none (0).
 
 	commandPending bool
+	commandEnded   bool
 	commandLines   []string
+
+	filePending bool
+	filePath    string
+	fileContent []byte
 }
 
 // Handler provides callbacks for processing transcript operations.
@@ -61,6 +69,22 @@ type Handler interface {
 	// Corresponds to cmdt syntax: "% dep <shell-args...>".
 	HandleDep(ctx context.Context, payload string) error
 
+	// HandleExternalize sets the size beyond which text output recorded by
+	// subsequent commands is written to a file instead of inlined.
+	// Corresponds to cmdt syntax: "% externalize <limit>".
+	HandleExternalize(ctx context.Context, limit ExternalizeLimit) error
+
+	// HandleFile writes a fixture file before subsequent commands run. Relative
+	// paths are relative to the shell's working directory.
+	// Corresponds to cmdt syntax: "% file <path>" followed by "| content" lines.
+	HandleFile(ctx context.Context, path string, content []byte) error
+
+	// HandleDirective processes a directive that is not built in, such as one
+	// registered by a library user. Handlers that do not know the directive
+	// should return an error.
+	// Corresponds to cmdt syntax: "% name args".
+	HandleDirective(ctx context.Context, name string, args string) error
+
 	// HandleExitCode processes the expected exit code of a command.
 	// If omitted in the transcript, the exit code defaults to 0.
 	// Corresponds to cmdt syntax: "? exitcode".
@@ -83,11 +107,30 @@ func (t *Interpreter) ExecTranscript(ctx context.Context, r io.Reader) error {
 		return fmt.Errorf("scanning: %w", err)
 	}
 
+	if err := t.flushFile(ctx); err != nil {
+		return err
+	}
 	return t.flushCommand(ctx)
 }
 
 func (t *Interpreter) ExecLine(ctx context.Context, text string) error {
 	hdlr := t.Handler
+	t.Line = text
+	if t.filePending {
+		switch {
+		case text == "|" || strings.HasPrefix(text, "| "):
+			t.FileLines = append(t.FileLines, text)
+			t.fileContent = append(t.fileContent, strings.TrimPrefix(strings.TrimPrefix(text, "|"), " ")+"\n"...)
+			return nil
+		case text == "% no-newline":
+			t.FileLines = append(t.FileLines, text)
+			t.fileContent = bytes.TrimSuffix(t.fileContent, []byte("\n"))
+			return t.flushFile(ctx)
+		}
+		if err := t.flushFile(ctx); err != nil {
+			return err
+		}
+	}
 	if strings.TrimSpace(text) == "" || text[0] == '#' {
 		if err := t.runPendingCommand(ctx); err != nil {
 			return err
@@ -107,9 +150,13 @@ func (t *Interpreter) ExecLine(ctx context.Context, text string) error {
 		}
 		t.CommandLineno = t.Lineno
 		t.commandPending = true
+		t.commandEnded = false
 		t.commandLines = []string{payload}
 		return nil
 
+	case "|":
+		return t.syntaxErrorf("unexpected file content")
+
 	case ">":
 		if !t.commandPending {
 			return t.syntaxErrorf("unexpected command continuation")
@@ -181,8 +228,39 @@ func (t *Interpreter) ExecLine(ctx context.Context, text string) error {
 			}
 			return hdlr.HandleDep(ctx, payload)
 
+		case "file":
+			path := strings.TrimSpace(payload)
+			if path == "" {
+				return t.syntaxErrorf("usage: %% file <path>")
+			}
+			// Files are written between commands.
+			if err := t.flushCommand(ctx); err != nil {
+				return err
+			}
+			t.acceptResults = false
+			t.filePending = true
+			t.filePath = path
+			t.fileContent = []byte{}
+			t.FileLines = []string{text}
+			return nil
+
+		case "externalize":
+			limit, err := ParseExternalizeLimit(payload)
+			if err != nil {
+				return t.syntaxErrorf("%w", err)
+			}
+			return hdlr.HandleExternalize(ctx, limit)
+
 		default:
-			return t.syntaxErrorf("invalid directive: %q", directive)
+			if directive == "" {
+				return t.syntaxErrorf("invalid directive: %q", directive)
+			}
+			// Custom directives apply between commands, like built-in ones.
+			if err := t.flushCommand(ctx); err != nil {
+				return err
+			}
+			t.acceptResults = false
+			return hdlr.HandleDirective(ctx, directive, payload)
 		}
 
 	default:
@@ -202,16 +280,25 @@ func (t *Interpreter) runPendingCommand(ctx context.Context) error {
 }
 
 func (t *Interpreter) flushCommand(ctx context.Context) error {
-	if t.CommandLineno == 0 {
+	if t.CommandLineno == 0 || t.commandEnded {
 		return nil
 	}
 	if err := t.runPendingCommand(ctx); err != nil {
 		return err
 	}
 	t.prevFD = 0
+	t.commandEnded = true
 	return t.Handler.HandleEnd(ctx)
 }
 
+func (t *Interpreter) flushFile(ctx context.Context) error {
+	if !t.filePending {
+		return nil
+	}
+	t.filePending = false
+	return t.Handler.HandleFile(ctx, t.filePath, t.fileContent)
+}
+
 func (t *Interpreter) syntaxErrorf(message string, v ...any) error {
 	return fmt.Errorf("syntax error on line %d: "+message, append([]any{t.Lineno}, v...)...)
 }
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IsMarkdown reports whether filename names a Markdown document, whose fenced
+// ```cmdt blocks are checked and updated rather than the file as a whole.
+func IsMarkdown(filename string) bool {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".md", ".markdown":
+		return true
+	default:
+		return false
+	}
+}
+
+// MarkdownDoc is a Markdown document containing fenced ```cmdt blocks.
+//
+// The blocks are run by converting the document to a transcript in which
+// every line outside of the blocks is a comment. Line numbers in the
+// transcript are then the same as in the document.
+type MarkdownDoc struct {
+	lines        []string
+	finalNewline bool
+	blocks       []markdownBlock
+}
+
+// markdownBlock holds the line indexes of a block's opening and closing
+// fences.
+type markdownBlock struct {
+	open, close int
+}
+
+// markdownMarker is the comment that stands in for the opening or closing
+// fence of a block, so that blocks can be found in an updated transcript.
+const markdownMarker = "#```cmdt "
+
+func ParseMarkdown(data []byte) (*MarkdownDoc, error) {
+	doc := &MarkdownDoc{
+		finalNewline: len(data) == 0 || data[len(data)-1] == '\n',
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		doc.lines = append(doc.lines, scanner.Text())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+
+	for i := 0; i < len(doc.lines); i++ {
+		fence, info, ok := parseFence(doc.lines[i])
+		if !ok {
+			continue
+		}
+		// Skip to the closing fence, which must use at least as many of the
+		// same character.
+		open := i
+		for i++; i < len(doc.lines); i++ {
+			closing, rest, ok := parseFence(doc.lines[i])
+			if ok && rest == "" && closing[0] == fence[0] && len(closing) >= len(fence) {
+				break
+			}
+		}
+		lang, _, _ := strings.Cut(info, " ")
+		if lang != "cmdt" {
+			continue
+		}
+		if i == len(doc.lines) {
+			return nil, fmt.Errorf("line %d: unclosed %scmdt block", open+1, fence)
+		}
+		doc.blocks = append(doc.blocks, markdownBlock{open: open, close: i})
+	}
+	return doc, nil
+}
+
+// parseFence parses a code fence line, such as "```cmdt", returning the
+// fence itself and the info string that follows it.
+func parseFence(line string) (fence, info string, ok bool) {
+	trimmed := strings.TrimLeft(line, " ")
+	if len(line)-len(trimmed) > 3 || trimmed == "" {
+		return "", "", false
+	}
+	ch := trimmed[0]
+	if ch != '`' && ch != '~' {
+		return "", "", false
+	}
+	n := len(trimmed) - len(strings.TrimLeft(trimmed, string(ch)))
+	if n < 3 {
+		return "", "", false
+	}
+	return trimmed[:n], strings.TrimSpace(trimmed[n:]), true
+}
+
+// NumBlocks returns the number of ```cmdt blocks in the document.
+func (doc *MarkdownDoc) NumBlocks() int {
+	return len(doc.blocks)
+}
+
+// Transcript returns the given blocks, or all blocks if none are given, as a
+// single transcript with the same line numbering as the document.
+func (doc *MarkdownDoc) Transcript(blocks ...int) []byte {
+	if len(blocks) == 0 {
+		for i := range doc.blocks {
+			blocks = append(blocks, i)
+		}
+	}
+	lines := make([]string, len(doc.lines))
+	for i := range lines {
+		lines[i] = "#"
+	}
+	for _, idx := range blocks {
+		block := doc.blocks[idx]
+		lines[block.open] = markdownMarker + strconv.Itoa(idx)
+		lines[block.close] = markdownMarker + strconv.Itoa(idx)
+		copy(lines[block.open+1:block.close], doc.lines[block.open+1:block.close])
+	}
+	var buf bytes.Buffer
+	for _, line := range lines {
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// ApplyTranscript replaces the contents of the blocks found in a transcript,
+// which was produced by Transcript and then updated.
+func (doc *MarkdownDoc) ApplyTranscript(transcript []byte) error {
+	contents := make(map[int][]string)
+	current := -1
+	for _, line := range strings.SplitAfter(string(transcript), "\n") {
+		line = strings.TrimSuffix(line, "\n")
+		if rest, ok := strings.CutPrefix(line, markdownMarker); ok {
+			idx, err := strconv.Atoi(rest)
+			if err != nil || idx < 0 || idx >= len(doc.blocks) {
+				return fmt.Errorf("invalid block marker: %q", line)
+			}
+			if current == -1 {
+				current = idx
+				contents[idx] = []string{}
+			} else {
+				current = -1
+			}
+			continue
+		}
+		if current != -1 {
+			contents[current] = append(contents[current], line)
+		}
+	}
+
+	// Splice in the new contents from the end, so that earlier line indexes
+	// remain valid.
+	for idx := len(doc.blocks) - 1; idx >= 0; idx-- {
+		content, ok := contents[idx]
+		if !ok {
+			continue
+		}
+		block := doc.blocks[idx]
+		tail := doc.lines[block.close:]
+		doc.lines = append(doc.lines[:block.open+1:block.open+1], append(content, tail...)...)
+		delta := len(content) - (block.close - block.open - 1)
+		doc.blocks[idx].close += delta
+		for later := idx + 1; later < len(doc.blocks); later++ {
+			doc.blocks[later].open += delta
+			doc.blocks[later].close += delta
+		}
+	}
+	return nil
+}
+
+// Bytes returns the text of the document.
+func (doc *MarkdownDoc) Bytes() []byte {
+	text := strings.Join(doc.lines, "\n")
+	if doc.finalNewline && len(doc.lines) > 0 {
+		text += "\n"
+	}
+	return []byte(text)
+}
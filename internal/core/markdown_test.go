@@ -0,0 +1,76 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMarkdownTranscript(t *testing.T) {
+	t.Parallel()
+
+	md := strings.Join([]string{
+		"# Title",
+		"```cmdt",
+		"$ echo one",
+		"```",
+		"~~~sh",
+		"```cmdt",
+		"~~~",
+		"````cmdt",
+		"$ echo two",
+		"1 old",
+		"````",
+		"",
+	}, "\n")
+
+	doc, err := ParseMarkdown([]byte(md))
+	if err != nil {
+		t.Fatalf("ParseMarkdown: %v", err)
+	}
+	if doc.NumBlocks() != 2 {
+		t.Fatalf("expected 2 blocks, got %d", doc.NumBlocks())
+	}
+
+	// Line numbers are preserved.
+	transcript := strings.Split(string(doc.Transcript()), "\n")
+	if transcript[2] != "$ echo one" || transcript[8] != "$ echo two" {
+		t.Fatalf("unexpected transcript:\n%s", strings.Join(transcript, "\n"))
+	}
+	if only := strings.Split(string(doc.Transcript(1)), "\n"); only[2] != "#" {
+		t.Fatalf("expected unselected block to be commented out, got %q", only[2])
+	}
+
+	// Updates replace only the contents of the blocks.
+	updated := strings.Replace(string(doc.Transcript()), "$ echo one\n", "$ echo one\n1 one\n", 1)
+	updated = strings.Replace(updated, "1 old\n", "1 two\n", 1)
+	if err := doc.ApplyTranscript([]byte(updated)); err != nil {
+		t.Fatalf("ApplyTranscript: %v", err)
+	}
+	want := strings.Join([]string{
+		"# Title",
+		"```cmdt",
+		"$ echo one",
+		"1 one",
+		"```",
+		"~~~sh",
+		"```cmdt",
+		"~~~",
+		"````cmdt",
+		"$ echo two",
+		"1 two",
+		"````",
+		"",
+	}, "\n")
+	if got := string(doc.Bytes()); got != want {
+		t.Fatalf("unexpected document:\n%s", got)
+	}
+}
+
+func TestParseMarkdownUnclosed(t *testing.T) {
+	t.Parallel()
+
+	_, err := ParseMarkdown([]byte("text\n```cmdt\n$ true\n"))
+	if err == nil || err.Error() != "line 2: unclosed ```cmdt block" {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
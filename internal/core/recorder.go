@@ -6,7 +6,10 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
+	"time"
 
 	"mvdan.cc/sh/v3/expand"
 	"mvdan.cc/sh/v3/interp"
@@ -49,6 +52,52 @@ func (lookupEnv) Each(fn func(name string, vr expand.Variable) bool) {
 	}
 }
 
+// overlayEnv overrides some variables of a base environment. Variables that
+// are not overridden are still looked up in the base, so that lookupEnv keeps
+// recording them for the test cache.
+type overlayEnv struct {
+	base  expand.Environ
+	names []string
+	vars  map[string]string
+}
+
+func newOverlayEnv(base expand.Environ, entries []string) *overlayEnv {
+	env := &overlayEnv{base: base, vars: make(map[string]string)}
+	for _, kv := range entries {
+		name, value, _ := strings.Cut(kv, "=")
+		if _, ok := env.vars[name]; !ok {
+			env.names = append(env.names, name)
+		}
+		env.vars[name] = value
+	}
+	return env
+}
+
+func (env *overlayEnv) Get(name string) expand.Variable {
+	if value, ok := env.vars[name]; ok {
+		return expand.Variable{
+			Kind:     expand.String,
+			Str:      value,
+			Exported: true,
+		}
+	}
+	return env.base.Get(name)
+}
+
+func (env *overlayEnv) Each(fn func(name string, vr expand.Variable) bool) {
+	for _, name := range env.names {
+		if !fn(name, env.Get(name)) {
+			return
+		}
+	}
+	env.base.Each(func(name string, vr expand.Variable) bool {
+		if _, ok := env.vars[name]; ok {
+			return true
+		}
+		return fn(name, vr)
+	})
+}
+
 // Recorder is a shell Interpreter that captures a command transcript
 // into the Transcript byte buffer.
 type Recorder struct {
@@ -58,37 +107,122 @@ type Recorder struct {
 	Stderr io.Writer
 	// Transcript captures the recorded output in cmdt format.
 	Transcript bytes.Buffer
+	// If provided, called instead of os.WriteFile for files referenced by the
+	// transcript (such as binary outputs).
+	WriteFile func(filename string, data []byte) error
+	// Text output over this limit is written to a file and referenced, like
+	// binary output.
+	Externalize ExternalizeLimit
+	// Initial working directory of the shell. Defaults to the working
+	// directory of the process.
+	Dir string
+	// Environment variables, as "NAME=value" entries, that override the
+	// environment of the process.
+	Env []string
+	// Commands implemented in Go, by name. They take precedence over
+	// executables on PATH, but not over shell builtins and functions.
+	Commands map[string]CommandFunc
+	// Custom directives, by name. Built-in directives cannot be overridden.
+	Directives map[string]DirectiveFunc
 
 	needsBlank     bool
+	outputMark     int               // Offset in Transcript of the last command's output.
+	commands       []recordedCommand // Recorded commands, for undo.
 	runner         *interp.Runner
 	stdoutBuf      bytes.Buffer
 	stderrBuf      bytes.Buffer
-	fileCount      int      // Counter for auto-generated binary file names
-	preferredFiles []string // List of preferred filenames in order (stderr first, then stdout)
-	fileIndex      int      // Current position in preferredFiles slice
+	fileCount      int             // Counter for auto-generated file names
+	preferredFiles []string        // List of preferred filenames in order (stderr first, then stdout)
+	fileIndex      int             // Current position in preferredFiles slice
+	fileRefs       map[int]string  // Files that output is written to, by fd.
+	reservedFiles  map[string]bool // Names never used for auto-generated files.
+	noNewline      []int           // Streams flushed with a `% no-newline` directive.
+	streams        streamTracker
+	afterNext      []func(*CommandResult) error // Directive hooks for the next command.
 }
 
 func (rec *Recorder) Init() error {
-	var err error
-	rec.runner, err = interp.New(
-		interp.Env(lookupEnv{}),
+	var env expand.Environ = lookupEnv{}
+	if len(rec.Env) > 0 {
+		env = newOverlayEnv(env, rec.Env)
+	}
+	opts := []interp.RunnerOption{
+		interp.Env(env),
 		interp.ExecHandlers(func(next interp.ExecHandlerFunc) interp.ExecHandlerFunc {
 			return func(ctx context.Context, args []string) error {
 				if len(args) > 0 && args[0] == "dep" {
 					return runDepIntrinsic(ctx, args[1:])
 				}
+				if len(args) > 0 {
+					if fn, ok := rec.Commands[args[0]]; ok {
+						return runCommandFunc(ctx, fn, args)
+					}
+				}
 				return next(ctx, args)
 			}
 		}),
 		interp.StdIO(nil,
-			io.MultiWriter(&rec.stdoutBuf, orDiscard(rec.Stdout)),
-			io.MultiWriter(&rec.stderrBuf, orDiscard(rec.Stderr)),
-		))
+			rec.streams.writer(1, io.MultiWriter(&rec.stdoutBuf, orDiscard(rec.Stdout))),
+			rec.streams.writer(2, io.MultiWriter(&rec.stderrBuf, orDiscard(rec.Stderr))),
+		),
+	}
+	if rec.Dir != "" {
+		opts = append(opts, interp.Dir(rec.Dir))
+	}
+	var err error
+	rec.runner, err = interp.New(opts...)
 	rec.preferredFiles = make([]string, 0)
 	rec.fileIndex = 0
 	return err
 }
 
+// streamTracker remembers the last byte written to each output stream, so
+// that callers echoing output can tell whether it ended mid-line.
+type streamTracker struct {
+	mu       sync.Mutex
+	lastByte map[int]byte
+	lastFD   int // Stream written to most recently, or 0 if none.
+}
+
+func (st *streamTracker) writer(fd int, w io.Writer) io.Writer {
+	return &trackingWriter{tracker: st, fd: fd, w: w}
+}
+
+func (st *streamTracker) reset() {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	st.lastByte = nil
+	st.lastFD = 0
+}
+
+// atLineStart reports whether the most recent write ended with a newline, or
+// if nothing has been written since the last reset.
+func (st *streamTracker) atLineStart() bool {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	return st.lastFD == 0 || st.lastByte[st.lastFD] == '\n'
+}
+
+type trackingWriter struct {
+	tracker *streamTracker
+	fd      int
+	w       io.Writer
+}
+
+func (tw *trackingWriter) Write(p []byte) (int, error) {
+	if len(p) > 0 {
+		st := tw.tracker
+		st.mu.Lock()
+		if st.lastByte == nil {
+			st.lastByte = make(map[int]byte)
+		}
+		st.lastByte[tw.fd] = p[len(p)-1]
+		st.lastFD = tw.fd
+		st.mu.Unlock()
+	}
+	return tw.w.Write(p)
+}
+
 func orDiscard(w io.Writer) io.Writer {
 	if w == nil {
 		return io.Discard
@@ -104,9 +238,16 @@ func (rec *Recorder) SetPreferredFiles(files []string) {
 	rec.fileIndex = 0
 }
 
-// generateBinaryFilename creates a filename, preferring existing names when available.
+// SetFileRefs sets the files that the next command's output is written to, by
+// file descriptor. Output on these descriptors is written to the given file
+// and recorded as a `1<` or `2<` reference, whether it is binary or text.
+func (rec *Recorder) SetFileRefs(refs map[int]string) {
+	rec.fileRefs = refs
+}
+
+// generateFilename creates a filename, preferring existing names when available.
 // Uses deterministic ordering (stderr first, then stdout) to consume preferred filenames.
-func (rec *Recorder) generateBinaryFilename() string {
+func (rec *Recorder) generateFilename(ext string) string {
 	// Check if we have a preferred filename available.
 	if rec.fileIndex < len(rec.preferredFiles) {
 		filename := rec.preferredFiles[rec.fileIndex]
@@ -114,9 +255,36 @@ func (rec *Recorder) generateBinaryFilename() string {
 		return filename
 	}
 
-	// Fall back to auto-generated filename.
-	rec.fileCount++
-	return fmt.Sprintf("%03d.bin", rec.fileCount)
+	// Fall back to an auto-generated filename, skipping names that are
+	// referenced elsewhere or already taken by a file on disk.
+	for {
+		rec.fileCount++
+		filename := fmt.Sprintf("%03d%s", rec.fileCount, ext)
+		if rec.reservedFiles[filename] || rec.fileExists(filename) {
+			continue
+		}
+		return filename
+	}
+}
+
+// reserveFilenames prevents the given names from being used for new output
+// files, because the transcript already references them.
+func (rec *Recorder) reserveFilenames(names ...string) {
+	if rec.reservedFiles == nil {
+		rec.reservedFiles = make(map[string]bool)
+	}
+	for _, name := range names {
+		rec.reservedFiles[name] = true
+	}
+}
+
+func (rec *Recorder) fileExists(filename string) bool {
+	path := filename
+	if rec.Dir != "" && !filepath.IsAbs(path) {
+		path = filepath.Join(rec.Dir, path)
+	}
+	_, err := os.Lstat(path)
+	return err == nil
 }
 
 func (rec *Recorder) flush() error {
@@ -141,17 +309,36 @@ func (rec *Recorder) flushBuffer(buf *bytes.Buffer, fd int) error {
 	data := buf.Bytes()
 	buf.Reset()
 
+	// Write output to the referenced file, if any.
+	if filename, ok := rec.fileRefs[fd]; ok {
+		if err := rec.writeFile(filename, data); err != nil {
+			return fmt.Errorf("writing file %q: %w", filename, err)
+		}
+		fmt.Fprintf(&rec.Transcript, "%d< %s\n", fd, filename)
+		return nil
+	}
+
 	// Check if data is binary.
 	if isBinary(data) {
 		// Write binary data to file and reference it.
-		filename := rec.generateBinaryFilename()
-		if err := os.WriteFile(filename, data, 0644); err != nil {
+		filename := rec.generateFilename(".bin")
+		if err := rec.writeFile(filename, data); err != nil {
 			return fmt.Errorf("writing binary file %q: %w", filename, err)
 		}
 		fmt.Fprintf(&rec.Transcript, "%d< %s\n", fd, filename)
 		return nil
 	}
 
+	// Write large text output to a file and reference it.
+	if rec.Externalize.Exceeded(data) {
+		filename := rec.generateFilename(".txt")
+		if err := rec.writeFile(filename, data); err != nil {
+			return fmt.Errorf("writing text file %q: %w", filename, err)
+		}
+		fmt.Fprintf(&rec.Transcript, "%d< %s\n", fd, filename)
+		return nil
+	}
+
 	// Handle text output - add prefix to each line and write to transcript.
 	for line := range bytes.Lines(data) {
 		if len(line) == 1 && line[0] == '\n' {
@@ -166,14 +353,39 @@ func (rec *Recorder) flushBuffer(buf *bytes.Buffer, fd int) error {
 	// Handle case where original didn't end with newline.
 	if len(data) > 0 && data[len(data)-1] != '\n' {
 		io.WriteString(&rec.Transcript, "\n% no-newline\n")
+		rec.noNewline = append(rec.noNewline, fd)
 	}
 
 	return nil
 }
 
+func (rec *Recorder) writeFile(filename string, data []byte) error {
+	if rec.WriteFile != nil {
+		return rec.WriteFile(filename, data)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// recordedCommand marks where a command begins in the Transcript.
+type recordedCommand struct {
+	command    string
+	mark       int
+	needsBlank bool
+}
+
 type CommandResult struct {
 	Output   []byte
 	ExitCode int
+	// Duration is how long the command took to run.
+	Duration time.Duration
+	// NoNewline lists the streams, by fd, whose output was recorded with
+	// `% no-newline`.
+	NoNewline []int
+	// AtLineStart is false if the last byte the command wrote to either stream
+	// was not a newline. A terminal echoing the output is then mid-line.
+	AtLineStart bool
+	// Errs reported by directives that inspected the command's result.
+	Errs []error
 }
 
 func (rec *Recorder) RunCommand(ctx context.Context, command string) (*CommandResult, error) {
@@ -184,33 +396,57 @@ func (rec *Recorder) RunCommand(ctx context.Context, command string) (*CommandRe
 
 	// Record command. Include a preceeding blank line for all but the first command.
 	beforeCommandMark := rec.Transcript.Len()
+	needsBlank := rec.needsBlank
 	if rec.needsBlank {
 		fmt.Fprintln(&rec.Transcript)
 		rec.needsBlank = false
 	}
 	rec.recordCommand(command)
 	afterCommandMark := rec.Transcript.Len()
+	rec.outputMark = afterCommandMark
 
 	// Execute command and record output.
+	rec.streams.reset()
+	rec.noNewline = nil
+	start := time.Now()
 	runErr := rec.runner.Run(ctx, stmt)
+	var res CommandResult
+	res.Duration = time.Since(start)
 	if err := rec.flush(); err != nil {
 		return nil, err
 	}
-	var res CommandResult
 	res.Output = rec.Transcript.Bytes()[afterCommandMark:rec.Transcript.Len()]
+	res.NoNewline = rec.noNewline
+	res.AtLineStart = rec.streams.atLineStart()
+	status, hasStatus := interp.IsExitStatus(runErr)
+	if hasStatus {
+		res.ExitCode = int(status)
+	}
+	hooks := rec.afterNext
+	rec.afterNext = nil
+	for _, hook := range hooks {
+		if err := hook(&res); err != nil {
+			res.Errs = append(res.Errs, err)
+		}
+	}
 
 	// Record exit code.
-	if status, ok := interp.IsExitStatus(runErr); ok {
-		res.ExitCode = int(status)
+	if hasStatus {
 		fmt.Fprintf(&rec.Transcript, "? %d\n", status)
 		rec.needsBlank = true
 		runErr = nil
 	}
 
-	// Assume final command is simply "exit", so exclude it from transcript.
-	// TODO: Validate this assumption.
-	if rec.runner.Exited() {
+	// Exclude a final "exit" from the transcript. The shell may also exit
+	// because a command failed under `set -e`, and such commands are kept.
+	if rec.runner.Exited() && callsExit(stmt) {
 		rec.Transcript.Truncate(beforeCommandMark)
+	} else {
+		rec.commands = append(rec.commands, recordedCommand{
+			command:    command,
+			mark:       beforeCommandMark,
+			needsBlank: needsBlank,
+		})
 	}
 
 	if runErr != nil {
@@ -241,6 +477,46 @@ func (rec *Recorder) RunDepDirective(ctx context.Context, payload string) error
 	return nil
 }
 
+// SetTranscript replaces the recorded transcript, such as to continue
+// recording at the end of an existing transcript. Undo history is discarded.
+func (rec *Recorder) SetTranscript(data []byte) {
+	rec.Transcript.Reset()
+	rec.Transcript.Write(data)
+	if len(data) > 0 && data[len(data)-1] != '\n' {
+		rec.Transcript.WriteByte('\n')
+	}
+	rec.needsBlank = len(data) > 0 && !bytes.HasSuffix(data, []byte("\n\n"))
+	rec.commands = nil
+}
+
+// Undo removes the most recently recorded command from the Transcript, along
+// with anything recorded after it, and returns the command's text. The effects
+// of running the command, such as changes to files or shell variables, are not
+// undone.
+func (rec *Recorder) Undo() (command string, ok bool) {
+	if len(rec.commands) == 0 {
+		return "", false
+	}
+	last := rec.commands[len(rec.commands)-1]
+	rec.commands = rec.commands[:len(rec.commands)-1]
+	rec.Transcript.Truncate(last.mark)
+	rec.needsBlank = last.needsBlank
+	return last.command, true
+}
+
+// WriteFixture writes a file for a `% file` directive. Relative paths are
+// resolved against the shell's working directory, and missing parent
+// directories are created.
+func (rec *Recorder) WriteFixture(path string, content []byte) error {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(rec.runner.Dir, path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, content, 0644)
+}
+
 func (rec *Recorder) RecordComment(text string) {
 	fmt.Fprintln(&rec.Transcript, text)
 	rec.needsBlank = false
@@ -262,6 +538,18 @@ func (rec *Recorder) Exited() bool {
 	return rec.runner.Exited()
 }
 
+// callsExit reports whether node calls the exit builtin.
+func callsExit(node syntax.Node) bool {
+	found := false
+	syntax.Walk(node, func(node syntax.Node) bool {
+		if call, ok := node.(*syntax.CallExpr); ok && len(call.Args) > 0 && call.Args[0].Lit() == "exit" {
+			found = true
+		}
+		return !found
+	})
+	return found
+}
+
 func parseStmt(s string) (syntax.Node, error) {
 	r := strings.NewReader(s)
 	f, err := syntax.NewParser().Parse(r, "")
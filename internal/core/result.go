@@ -0,0 +1,140 @@
+package core
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CheckStatus is the outcome of checking a command.
+type CheckStatus int
+
+const (
+	// CheckPassed means the command's output and exit code matched.
+	CheckPassed CheckStatus = iota
+	// CheckFailed means the command's output or exit code differed.
+	CheckFailed
+)
+
+func (status CheckStatus) String() string {
+	switch status {
+	case CheckPassed:
+		return "pass"
+	case CheckFailed:
+		return "fail"
+	default:
+		return "CheckStatus(" + strconv.Itoa(int(status)) + ")"
+	}
+}
+
+// CheckResult describes a checked command.
+type CheckResult struct {
+	// Line of the command, and its text, which may span several lines.
+	Lineno  int
+	Command string
+
+	Status   CheckStatus
+	Duration time.Duration
+	// Errs describe why the command failed, if it did.
+	Errs []error
+
+	// Output in cmdt format, interleaving both streams.
+	ExpectedOutput string
+	ActualOutput   string
+	// Output of each stream, by fd (1 for stdout, 2 for stderr), as the
+	// command wrote it. Output referenced as a binary file is omitted.
+	ExpectedStreams map[int]string
+	ActualStreams   map[int]string
+
+	ExpectedExitCode int
+	ActualExitCode   int
+}
+
+// newCheckResult compares the result of a command with its expectations.
+func newCheckResult(lineno int, command string, expectedOutput string, expectedExitCode int, actual *CommandResult, actualOutput string) *CheckResult {
+	var errs []error
+	if expectedOutput != actualOutput {
+		errs = append(errs, DiffError{
+			Expected: expectedOutput,
+			Actual:   actualOutput,
+		})
+	}
+	if expectedExitCode != actual.ExitCode {
+		errs = append(errs,
+			fmt.Errorf("expected exit code %d, but got %d",
+				expectedExitCode,
+				actual.ExitCode))
+	}
+	errs = append(errs, actual.Errs...)
+
+	result := &CheckResult{
+		Lineno:           lineno,
+		Command:          command,
+		Status:           CheckPassed,
+		Duration:         actual.Duration,
+		Errs:             errs,
+		ExpectedOutput:   expectedOutput,
+		ActualOutput:     actualOutput,
+		ExpectedStreams:  splitStreams(expectedOutput),
+		ActualStreams:    splitStreams(actualOutput),
+		ExpectedExitCode: expectedExitCode,
+		ActualExitCode:   actual.ExitCode,
+	}
+	if len(errs) > 0 {
+		result.Status = CheckFailed
+	}
+	return result
+}
+
+// Observer is notified of progress while a transcript is checked, which
+// allows custom reporters to show results as they happen.
+type Observer interface {
+	// CommandStarted is called before a command runs.
+	CommandStarted(ctx context.Context, lineno int, command string)
+	// CommandChecked is called after a command ran and was checked.
+	CommandChecked(ctx context.Context, result *CheckResult)
+}
+
+// splitStreams separates output in cmdt format into the text of each stream.
+func splitStreams(output string) map[int]string {
+	streams := make(map[int]*strings.Builder)
+	lastFD := 0
+	for line := range strings.Lines(output) {
+		line = strings.TrimSuffix(line, "\n")
+		if line == "% no-newline" {
+			if b := streams[lastFD]; b != nil {
+				text := strings.TrimSuffix(b.String(), "\n")
+				b.Reset()
+				b.WriteString(text)
+			}
+			continue
+		}
+		if line == "" || (line[0] != '1' && line[0] != '2') {
+			continue
+		}
+		var text string
+		switch rest := line[1:]; {
+		case rest == "":
+			text = "\n"
+		case rest[0] == ' ':
+			text = rest[1:] + "\n"
+		default:
+			continue // File references, such as `1< 001.bin`.
+		}
+		fd := int(line[0] - '0')
+		lastFD = fd
+		b := streams[fd]
+		if b == nil {
+			b = &strings.Builder{}
+			streams[fd] = b
+		}
+		b.WriteString(text)
+	}
+	texts := make(map[int]string, len(streams))
+	for fd, b := range streams {
+		texts[fd] = b.String()
+	}
+	return texts
+}
@@ -0,0 +1,90 @@
+package core
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type recordingObserver struct {
+	events []string
+}
+
+func (o *recordingObserver) CommandStarted(ctx context.Context, lineno int, command string) {
+	o.events = append(o.events, "start "+command)
+}
+
+func (o *recordingObserver) CommandChecked(ctx context.Context, result *CheckResult) {
+	o.events = append(o.events, result.Status.String()+" "+result.Command)
+}
+
+func TestCheckTranscriptResults(t *testing.T) {
+	transcript := `$ echo hello
+1 goodbye
+
+$ { printf out; echo err >&2; false; }
+2 err
+1 out
+% no-newline
+? 1
+
+$ true
+`
+	obs := &recordingObserver{}
+	ckr := &Checker{Observer: obs}
+	results, err := ckr.CheckTranscriptResults(context.Background(), strings.NewReader(transcript))
+	if !assert.NoError(t, err) || !assert.Len(t, results, 3) {
+		return
+	}
+
+	failed := results[0]
+	assert.Equal(t, 1, failed.Lineno)
+	assert.Equal(t, CheckFailed, failed.Status)
+	assert.Equal(t, map[int]string{1: "goodbye\n"}, failed.ExpectedStreams)
+	assert.Equal(t, map[int]string{1: "hello\n"}, failed.ActualStreams)
+	assert.Len(t, failed.Errs, 1)
+
+	passed := results[1]
+	assert.Equal(t, 4, passed.Lineno)
+	assert.Equal(t, CheckPassed, passed.Status)
+	assert.Equal(t, map[int]string{1: "out", 2: "err\n"}, passed.ActualStreams)
+	assert.Equal(t, 1, passed.ExpectedExitCode)
+	assert.Equal(t, 1, passed.ActualExitCode)
+
+	assert.Equal(t, CheckPassed, results[2].Status)
+	assert.Equal(t, []string{
+		"start echo hello",
+		"fail echo hello",
+		"start { printf out; echo err >&2; false; }",
+		"pass { printf out; echo err >&2; false; }",
+		"start true",
+		"pass true",
+	}, obs.events)
+}
+
+func TestCheckTranscriptResultsRunError(t *testing.T) {
+	obs := &recordingObserver{}
+	ckr := &Checker{Observer: obs}
+	results, err := ckr.CheckTranscriptResults(context.Background(), strings.NewReader("$ true\n\n$ echo 'oops\n"))
+	assert.Error(t, err)
+	if !assert.Len(t, results, 2) {
+		return
+	}
+	assert.Equal(t, CheckFailed, results[1].Status)
+	assert.Equal(t, 3, results[1].Lineno)
+	assert.Len(t, results[1].Errs, 1)
+	assert.Equal(t, []string{
+		"start true",
+		"pass true",
+		"start echo 'oops",
+		"fail echo 'oops",
+	}, obs.events)
+}
+
+func TestSplitStreams(t *testing.T) {
+	assert.Equal(t, map[int]string{}, splitStreams("1< 001.bin\n"))
+	assert.Equal(t, map[int]string{1: "out"}, splitStreams("2< 001.bin\n1 out\n% no-newline\n"))
+	assert.Equal(t, map[int]string{1: "a\n\nb\n"}, splitStreams("1 a\n1\n1 b\n"))
+}
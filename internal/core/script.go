@@ -0,0 +1,100 @@
+package core
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// RecordScript runs each top-level statement of a shell script, recording it
+// as a command in the Transcript. Comments and blank lines between statements
+// are recorded as-is, and statements spanning several lines are recorded with
+// `>` continuation lines. Recording stops early if the script exits. If it
+// exits because a command failed under `set -e`, that command is recorded
+// along with its exit code, and a ScriptExitError is returned.
+func (rec *Recorder) RecordScript(ctx context.Context, r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	var lines []string // Input of an incomplete statement.
+	blanks := 0        // Blank lines not yet recorded.
+	lineno := 0
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+
+		// Comments and blank lines are recorded as-is, unless part of a statement.
+		if len(lines) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if lineno == 1 && strings.HasPrefix(trimmed, "#!") {
+				continue
+			}
+			if trimmed == "" {
+				blanks++
+				continue
+			}
+			rec.recordBlanks(&blanks)
+			if strings.HasPrefix(trimmed, "#") {
+				rec.RecordComment(trimmed)
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+		source := strings.Join(lines, "\n")
+		f, err := syntax.NewParser().Parse(strings.NewReader(source), "")
+		if err != nil {
+			if syntax.IsIncomplete(err) {
+				continue
+			}
+			return fmt.Errorf("line %d: %w", lineno, err)
+		}
+		lines = nil
+
+		for i, command := range splitStmts(source, f.Stmts) {
+			res, err := rec.RunCommand(ctx, command)
+			if err != nil {
+				return err
+			}
+			if rec.Exited() {
+				if callsExit(f.Stmts[i]) {
+					return nil
+				}
+				return ScriptExitError{Lineno: lineno, ExitCode: res.ExitCode}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	if len(lines) > 0 {
+		return fmt.Errorf("line %d: unexpected end of script", lineno)
+	}
+	return nil
+}
+
+func (rec *Recorder) recordBlanks(n *int) {
+	for ; *n > 0; *n-- {
+		rec.RecordComment("")
+	}
+}
+
+// splitStmts returns the source text of each statement. A lone statement
+// keeps its whole source, including any trailing comment.
+func splitStmts(source string, stmts []*syntax.Stmt) []string {
+	if len(stmts) == 1 {
+		return []string{strings.TrimSpace(source)}
+	}
+	commands := make([]string, len(stmts))
+	for i, stmt := range stmts {
+		end := len(source)
+		if i+1 < len(stmts) {
+			end = int(stmts[i+1].Pos().Offset())
+		}
+		text := source[stmt.Pos().Offset():end]
+		commands[i] = strings.TrimRight(text, " \t\n;")
+	}
+	return commands
+}
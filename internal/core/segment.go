@@ -0,0 +1,84 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Segment is a contiguous run of transcript lines. A command segment holds a
+// command (including continuation lines) along with all of its expectations.
+// All other lines (comments, blank lines, and directives that are not tied to
+// a command's output) are grouped into non-command segments.
+type Segment struct {
+	Lineno  int // Line number of the first line of the segment.
+	Lines   []string
+	Command bool
+}
+
+// String returns the segment's lines, each terminated with a newline.
+func (seg Segment) String() string {
+	var sb strings.Builder
+	for _, line := range seg.Lines {
+		sb.WriteString(line)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// FileRefs returns the paths referenced by `1<` and `2<` lines in the segment.
+func (seg Segment) FileRefs() []string {
+	var refs []string
+	for _, line := range seg.Lines {
+		if strings.HasPrefix(line, "1< ") || strings.HasPrefix(line, "2< ") {
+			refs = append(refs, line[3:])
+		}
+	}
+	return refs
+}
+
+// SplitSegments splits a transcript into segments without executing it.
+// Concatenating the String of every segment reproduces the input, modulo a
+// missing trailing newline.
+func SplitSegments(r io.Reader) ([]Segment, error) {
+	var segs []Segment
+	var cur *Segment
+	lineno := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		// A no-newline directive after file content belongs to the file.
+		command := isCommandLine(line) && !(line == "% no-newline" && cur != nil && !cur.Command)
+		if cur == nil || cur.Command != command || isCommandStart(line) {
+			segs = append(segs, Segment{
+				Lineno:  lineno,
+				Command: command,
+			})
+			cur = &segs[len(segs)-1]
+		}
+		cur.Lines = append(cur.Lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+	return segs, nil
+}
+
+func isCommandStart(line string) bool {
+	return line == "$" || strings.HasPrefix(line, "$ ")
+}
+
+// isCommandLine reports whether the line belongs to a command segment.
+func isCommandLine(line string) bool {
+	opcode, _, _ := strings.Cut(line, " ")
+	switch opcode {
+	case "$", ">", "1", "2", "1<", "2<", "?":
+		return true
+	case "%":
+		return line == "% no-newline"
+	default:
+		return false
+	}
+}
@@ -0,0 +1,65 @@
+package core
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSplitSegments(t *testing.T) {
+	t.Parallel()
+
+	cmdt := strings.Join([]string{
+		"# comment",
+		"% dep config.json",
+		"$ cat <<EOF",
+		"> hi",
+		"> EOF",
+		"1 hi",
+		"$ printf bin",
+		"1< 001.bin",
+		"% no-newline",
+		"? 1",
+		"",
+		"$ true",
+		"",
+	}, "\n")
+
+	segs, err := SplitSegments(strings.NewReader(cmdt))
+	if err != nil {
+		t.Fatalf("SplitSegments: %v", err)
+	}
+
+	type want struct {
+		lineno  int
+		command bool
+		lines   int
+	}
+	wants := []want{
+		{lineno: 1, command: false, lines: 2},
+		{lineno: 3, command: true, lines: 4},
+		{lineno: 7, command: true, lines: 4},
+		{lineno: 11, command: false, lines: 1},
+		{lineno: 12, command: true, lines: 1},
+	}
+	if len(segs) != len(wants) {
+		t.Fatalf("got %d segments, want %d", len(segs), len(wants))
+	}
+	for i, w := range wants {
+		seg := segs[i]
+		if seg.Lineno != w.lineno || seg.Command != w.command || len(seg.Lines) != w.lines {
+			t.Errorf("segment %d = {Lineno: %d, Command: %v, lines: %d}, want %+v",
+				i, seg.Lineno, seg.Command, len(seg.Lines), w)
+		}
+	}
+
+	var sb strings.Builder
+	for _, seg := range segs {
+		sb.WriteString(seg.String())
+	}
+	if sb.String() != cmdt {
+		t.Errorf("segments do not reassemble input:\n%s", sb.String())
+	}
+	if refs := segs[2].FileRefs(); len(refs) != 1 || refs[0] != "001.bin" {
+		t.Errorf("FileRefs() = %q", refs)
+	}
+}
@@ -0,0 +1,107 @@
+package core
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	filepathpkg "path/filepath"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// StaticDeps returns the files that a transcript is known to depend on without
+// running it: the files referenced by `1<` / `2<` lines and the literal paths
+// declared by `% dep` directives, including the contents of depfiles.
+//
+// Relative paths are resolved against dir. Dependencies that can only be
+// determined by running the transcript (such as those that use parameter
+// expansion, or that follow a `cd`) are not included.
+func StaticDeps(dir string, r io.Reader) ([]string, error) {
+	var deps []string
+	addDep := func(path string) {
+		if path == "" {
+			return
+		}
+		if !filepathpkg.IsAbs(path) {
+			path = filepathpkg.Join(dir, path)
+		}
+		deps = append(deps, path)
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case strings.HasPrefix(line, "1< "), strings.HasPrefix(line, "2< "):
+			addDep(line[3:])
+
+		case strings.HasPrefix(line, "% dep "):
+			node, err := parseStmt("dep " + strings.TrimPrefix(line, "% dep "))
+			if err != nil {
+				continue
+			}
+			if err := validateDepStmt(node); err != nil {
+				continue
+			}
+			stmt := node.(*syntax.Stmt)
+			for _, arg := range stmt.Cmd.(*syntax.CallExpr).Args[1:] {
+				if s, ok := literalWord(arg); ok && !strings.HasPrefix(s, "$") {
+					addDep(depUnescape(s))
+				}
+			}
+			for _, redir := range stmt.Redirs {
+				depfile, ok := literalWord(redir.Word)
+				if !ok {
+					continue
+				}
+				addDep(depfile)
+				f, err := os.Open(deps[len(deps)-1])
+				if err != nil {
+					continue
+				}
+				err = scanDepfile(f, func(dep string, env bool) {
+					if !env {
+						addDep(dep)
+					}
+				})
+				f.Close()
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("scanning: %w", err)
+	}
+	return deps, nil
+}
+
+// literalWord returns the value of a shell word that requires no expansion.
+func literalWord(w *syntax.Word) (string, bool) {
+	if w == nil {
+		return "", false
+	}
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, part := range part.Parts {
+				lit, ok := part.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
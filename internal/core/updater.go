@@ -3,54 +3,278 @@ package core
 import (
 	"bytes"
 	"context"
+	"errors"
 	"fmt"
 	"io"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
 )
 
 type Updater struct {
+	// If provided, commands are run by this initialized recorder rather than a
+	// new one, in which case Dir, Env, Commands and Directives are ignored.
+	Recorder *Recorder
+	// If provided, notified as each command is run and checked against the
+	// expectations it had before updating.
+	Observer Observer
+	// If provided, called instead of os.WriteFile for files referenced by the
+	// updated transcript. See Recorder.WriteFile.
+	WriteFile func(filename string, data []byte) error
+	// If non-empty, only commands spanning one of these line numbers have
+	// their expectations updated. All commands are still executed.
+	Lines []int
+	// If set, only commands whose output or exit code fail to match their
+	// expectations are updated.
+	OnlyFailing bool
+	// Text output over this limit is written to a file and referenced. May be
+	// overridden by `% externalize` directives.
+	Externalize ExternalizeLimit
+	// Initial working directory and environment overrides of the session,
+	// and commands implemented in Go and custom directives. See Recorder.
+	// Referenced files with relative names are written relative to Dir.
+	Dir        string
+	Env        []string
+	Commands   map[string]CommandFunc
+	Directives map[string]DirectiveFunc
+
 	rec            *Recorder
-	lineno         int
-	fileRefs       []string // File references for current command
+	interp         *Interpreter
+	fileRefs       []string       // File references for current command
+	fdFileRefs     map[int]string // First file reference per fd for current command
 	currentCommand string
+
+	// Expectations of the current command, for commands not being updated.
+	expectLines      []string         // As written in the transcript.
+	expectPieces     []expectedOutput // As interpreted by the checker.
+	expectedExitCode int
+	lastLineno       int // Last line of the current command and its expectations.
+
+	// Referenced files written by the current command, which are only
+	// written out if the command is updated.
+	pendingFiles []pendingFile
+}
+
+// expectedOutput is either an inline output line or a file reference.
+type expectedOutput struct {
+	text string
+	fd   int
+	file string
+}
+
+type pendingFile struct {
+	filename string
+	data     []byte
 }
 
 func (upr *Updater) UpdateTranscript(ctx context.Context, r io.Reader) (transcript *bytes.Buffer, err error) {
 	// Initialize recorder for streaming processing.
-	upr.rec = &Recorder{}
-	if err := upr.rec.Init(); err != nil {
-		return nil, fmt.Errorf("initializing recorder: %w", err)
+	upr.rec = upr.Recorder
+	if upr.rec == nil {
+		upr.rec = &Recorder{
+			Dir:        upr.Dir,
+			Env:        upr.Env,
+			Commands:   upr.Commands,
+			Directives: upr.Directives,
+		}
+		if err := upr.rec.Init(); err != nil {
+			return nil, fmt.Errorf("initializing recorder: %w", err)
+		}
+	}
+	writeFile, externalize := upr.rec.WriteFile, upr.rec.Externalize
+	upr.rec.WriteFile = func(filename string, data []byte) error {
+		upr.pendingFiles = append(upr.pendingFiles, pendingFile{filename, data})
+		return nil
 	}
+	upr.rec.Externalize = upr.Externalize
+	defer func() {
+		upr.rec.WriteFile, upr.rec.Externalize = writeFile, externalize
+	}()
+
+	// New output files must not take the name of a file that a later command
+	// references, so collect every reference before running anything.
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	upr.rec.reserveFilenames(fileReferences(data)...)
 
 	// Use the regular interpreter with the updater as handler.
-	interp := &Interpreter{
+	upr.interp = &Interpreter{
 		Handler: upr,
 	}
-	if err := interp.ExecTranscript(ctx, r); err != nil {
+	if err := upr.interp.ExecTranscript(ctx, bytes.NewReader(data)); err != nil {
 		return nil, err
 	}
 	return &upr.rec.Transcript, nil
 }
 
+// fileReferences returns the files referenced by `1<` and `2<` lines of a
+// transcript.
+func fileReferences(transcript []byte) []string {
+	var refs []string
+	for line := range bytes.Lines(transcript) {
+		line = bytes.TrimRight(line, "\r\n")
+		for _, prefix := range []string{"1< ", "2< "} {
+			if ref, ok := bytes.CutPrefix(line, []byte(prefix)); ok {
+				refs = append(refs, string(ref))
+			}
+		}
+	}
+	return refs
+}
+
 func (upr *Updater) flushCurrentCommand(ctx context.Context) error {
 	if upr.currentCommand == "" {
 		return nil // No command to flush
 	}
 
-	// Set up recorder with file references for this command
-	upr.rec.SetPreferredFiles(upr.fileRefs)
+	// Set up recorder with file references for this command. Output on a
+	// stream that referenced a file is written back to that file. Any other
+	// references are reused as names for new binary output.
+	var preferred []string
+	for _, ref := range upr.fileRefs {
+		if !slices.Contains(slices.Collect(maps.Values(upr.fdFileRefs)), ref) {
+			preferred = append(preferred, ref)
+		}
+	}
+	upr.rec.SetPreferredFiles(preferred)
+	upr.rec.SetFileRefs(upr.fdFileRefs)
 
 	// Execute the command
-	if _, err := upr.rec.RunCommand(ctx, upr.currentCommand); err != nil {
+	if upr.Observer != nil {
+		upr.Observer.CommandStarted(ctx, upr.interp.CommandLineno, upr.currentCommand)
+	}
+	res, err := upr.rec.RunCommand(ctx, upr.currentCommand)
+	if err != nil {
+		if upr.Observer != nil {
+			upr.Observer.CommandChecked(ctx, &CheckResult{
+				Lineno:  upr.interp.CommandLineno,
+				Command: upr.currentCommand,
+				Status:  CheckFailed,
+				Errs:    []error{err},
+			})
+		}
 		return err
 	}
+	var result *CheckResult
+	if upr.Observer != nil || upr.OnlyFailing {
+		result = upr.check(res)
+	}
+	if upr.Observer != nil {
+		upr.Observer.CommandChecked(ctx, result)
+	}
+	if len(res.Errs) > 0 {
+		// Directive checks can't be fixed by updating expectations.
+		return fmt.Errorf("error on line %d: %w", upr.interp.CommandLineno, errors.Join(res.Errs...))
+	}
+
+	update := upr.selected()
+	if update && upr.OnlyFailing {
+		update = result.Status == CheckFailed
+	}
+	if update {
+		for _, file := range upr.pendingFiles {
+			if err := upr.writeFile(file.filename, file.data); err != nil {
+				return err
+			}
+		}
+	} else if !upr.rec.Exited() {
+		// Replace the recorded output with the expectations as written.
+		upr.rec.Transcript.Truncate(upr.rec.outputMark)
+		for _, line := range upr.expectLines {
+			fmt.Fprintln(&upr.rec.Transcript, line)
+		}
+		upr.rec.needsBlank = false
+	}
 
 	// Clear the buffer
 	upr.fileRefs = nil
+	upr.fdFileRefs = nil
 	upr.currentCommand = ""
+	upr.expectLines = nil
+	upr.expectPieces = nil
+	upr.expectedExitCode = 0
+	upr.lastLineno = 0
+	upr.pendingFiles = nil
 
 	return nil
 }
 
+// selected reports whether the current command is targeted by Lines.
+func (upr *Updater) selected() bool {
+	if len(upr.Lines) == 0 {
+		return true
+	}
+	first := upr.interp.CommandLineno
+	last := max(first+strings.Count(upr.currentCommand, "\n"), upr.lastLineno)
+	return slices.ContainsFunc(upr.Lines, func(lineno int) bool {
+		return first <= lineno && lineno <= last
+	})
+}
+
+// check compares the result of the current command with its expectations,
+// using the same rules as the Checker.
+func (upr *Updater) check(res *CommandResult) *CheckResult {
+	var expected strings.Builder
+	var errs []error
+	for _, piece := range upr.expectPieces {
+		if piece.file == "" {
+			expected.WriteString(piece.text)
+			continue
+		}
+		text, data, err := expectedFileOutput(upr.rec, piece.fd, piece.file)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if data != nil && !upr.wrote(piece.file, data) {
+			errs = append(errs, fmt.Errorf("output differs from %s", piece.file))
+		}
+		expected.WriteString(text)
+	}
+	result := newCheckResult(
+		upr.interp.CommandLineno,
+		upr.currentCommand,
+		expected.String(),
+		upr.expectedExitCode,
+		res,
+		string(res.Output),
+	)
+	if len(errs) > 0 {
+		result.Errs = append(result.Errs, errs...)
+		result.Status = CheckFailed
+	}
+	return result
+}
+
+// wrote reports whether the current command wrote the given data to the
+// referenced file.
+func (upr *Updater) wrote(filename string, data []byte) bool {
+	return slices.ContainsFunc(upr.pendingFiles, func(file pendingFile) bool {
+		return file.filename == filename && bytes.Equal(file.data, data)
+	})
+}
+
+func (upr *Updater) writeFile(filename string, data []byte) error {
+	if upr.WriteFile != nil {
+		return upr.WriteFile(filename, data)
+	}
+	if upr.rec.Dir != "" && !filepath.IsAbs(filename) {
+		filename = filepath.Join(upr.rec.Dir, filename)
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// expect records an expectation line of the current command.
+func (upr *Updater) expect(piece expectedOutput) {
+	upr.expectLines = append(upr.expectLines, upr.interp.Line)
+	upr.expectPieces = append(upr.expectPieces, piece)
+	upr.lastLineno = upr.interp.Lineno
+}
+
 func (upr *Updater) HandleComment(ctx context.Context, text string) error {
 	// Flush any buffered command before processing comments to maintain order
 	if err := upr.flushCurrentCommand(ctx); err != nil {
@@ -73,18 +297,31 @@ func (upr *Updater) HandleRun(ctx context.Context, command string) error {
 }
 
 func (upr *Updater) HandleOutput(ctx context.Context, fd int, line string) error {
-	// Output lines are ignored in update mode - we only care about file references
+	// Output lines are only kept for commands that are not being updated.
+	sep := ""
+	if len(line) > 0 {
+		sep = " "
+	}
+	upr.expect(expectedOutput{text: fmt.Sprintf("%d%s%s\n", fd, sep, line)})
 	return nil
 }
 
 func (upr *Updater) HandleFileOutput(ctx context.Context, fd int, filepath string) error {
 	// Collect file references for the current command
 	upr.fileRefs = append(upr.fileRefs, filepath)
+	if _, ok := upr.fdFileRefs[fd]; !ok {
+		if upr.fdFileRefs == nil {
+			upr.fdFileRefs = make(map[int]string)
+		}
+		upr.fdFileRefs[fd] = filepath
+	}
+	upr.expect(expectedOutput{fd: fd, file: filepath})
 	return nil
 }
 
 func (upr *Updater) HandleNoNewline(ctx context.Context, fd int) error {
-	// No-newline directives are ignored in update mode
+	// No-newline directives are only kept for commands that are not being updated.
+	upr.expect(expectedOutput{text: "% no-newline\n"})
 	return nil
 }
 
@@ -98,8 +335,53 @@ func (upr *Updater) HandleDep(ctx context.Context, payload string) error {
 	return nil
 }
 
+func (upr *Updater) HandleExternalize(ctx context.Context, limit ExternalizeLimit) error {
+	// Keep the directive, and apply it to subsequently recorded commands.
+	if err := upr.flushCurrentCommand(ctx); err != nil {
+		return err
+	}
+	upr.rec.RecordComment(upr.interp.Line)
+	upr.rec.Externalize = limit
+	return nil
+}
+
+func (upr *Updater) HandleFile(ctx context.Context, path string, content []byte) error {
+	// Keep the directive as written, and write the file for subsequent commands.
+	if err := upr.flushCurrentCommand(ctx); err != nil {
+		return err
+	}
+	for _, line := range upr.interp.FileLines {
+		upr.rec.RecordComment(line)
+	}
+	if err := upr.rec.WriteFixture(path, content); err != nil {
+		return fmt.Errorf("writing file %q: %w", path, err)
+	}
+	return nil
+}
+
+func (upr *Updater) HandleDirective(ctx context.Context, name string, args string) error {
+	// Keep the directive as written, and run it so that it affects subsequent
+	// commands as it would when checking.
+	if err := upr.flushCurrentCommand(ctx); err != nil {
+		return err
+	}
+	upr.rec.RecordComment(upr.interp.Line)
+	ok, err := upr.rec.runDirective(ctx, name, args, upr.interp.Lineno)
+	if !ok {
+		return fmt.Errorf("syntax error on line %d: invalid directive: %q", upr.interp.Lineno, name)
+	}
+	if err != nil {
+		return fmt.Errorf("error on line %d: %s: %w", upr.interp.Lineno, name, err)
+	}
+	return nil
+}
+
 func (upr *Updater) HandleExitCode(ctx context.Context, exitCode int) error {
-	// Exit codes are ignored in update mode, but flush the command now that we have all its output
+	// Keep the exit code for commands that are not being updated, then flush the
+	// command now that we have all its output.
+	upr.expectLines = append(upr.expectLines, upr.interp.Line)
+	upr.expectedExitCode = exitCode
+	upr.lastLineno = upr.interp.Lineno
 	return upr.flushCurrentCommand(ctx)
 }
 
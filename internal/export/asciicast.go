@@ -0,0 +1,137 @@
+package export
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Timing of asciicast replays, in seconds. Commands are "typed" at a steady
+// pace, and their output appears after a short delay.
+const (
+	asciicastTypingDelay = 0.05
+	asciicastOutputDelay = 0.3
+	asciicastPause       = 1.0
+)
+
+// ANSI escape sequences used to style asciicast output.
+const (
+	ansiDim   = "\x1b[2m"
+	ansiRed   = "\x1b[31m"
+	ansiReset = "\x1b[0m"
+)
+
+// Asciicast renders a transcript as an asciicast v2 recording, which can be
+// replayed with asciinema. The recording is re-timed as if each command were
+// typed at a prompt, and stderr is shown in red.
+func Asciicast(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+	header := struct {
+		Version int    `json:"version"`
+		Width   int    `json:"width"`
+		Height  int    `json:"height"`
+		Title   string `json:"title,omitempty"`
+	}{
+		Version: 2,
+		Width:   80,
+		Height:  24,
+		Title:   opts.Title,
+	}
+	if err := json.NewEncoder(bw).Encode(header); err != nil {
+		return err
+	}
+
+	ac := &asciicastWriter{w: bw}
+	for _, item := range t.Items {
+		switch {
+		case item.Command != nil:
+			ac.command(item.Command)
+		case item.File != nil:
+			ac.file(item.File)
+		case item.IsBlank:
+		default:
+			ac.output(ansiDim + "# " + item.Comment + ansiReset + "\n")
+		}
+	}
+	if ac.err != nil {
+		return ac.err
+	}
+	return bw.Flush()
+}
+
+type asciicastWriter struct {
+	w    io.Writer
+	time float64
+	err  error
+}
+
+// output emits an output event at the current time, translating newlines for
+// the terminal.
+func (ac *asciicastWriter) output(data string) {
+	if ac.err != nil || data == "" {
+		return
+	}
+	data = strings.ReplaceAll(data, "\n", "\r\n")
+	event := []any{roundTime(ac.time), "o", data}
+	line, err := json.Marshal(event)
+	if err != nil {
+		ac.err = err
+		return
+	}
+	_, ac.err = fmt.Fprintf(ac.w, "%s\n", line)
+}
+
+func (ac *asciicastWriter) command(cmd *Command) {
+	for i, line := range strings.Split(cmd.Text, "\n") {
+		prompt := "$ "
+		if i > 0 {
+			prompt = "> "
+		}
+		ac.output(prompt)
+		for _, ch := range line {
+			ac.time += asciicastTypingDelay
+			ac.output(string(ch))
+		}
+		ac.time += asciicastTypingDelay
+		ac.output("\n")
+	}
+
+	ac.time += asciicastOutputDelay
+	for _, out := range cmd.Output {
+		var text string
+		if out.File != "" {
+			text = fmt.Sprintf("%s[%s: %s]%s\n", ansiDim, streamName(out.FD), out.File, ansiReset)
+		} else {
+			text = out.Text
+			if !strings.HasSuffix(text, "\n") {
+				text += "\n"
+			}
+			if out.FD == 2 {
+				text = ansiRed + text + ansiReset
+			}
+		}
+		ac.output(text)
+	}
+	if cmd.ExitCode != 0 {
+		ac.output(fmt.Sprintf("%s[exit status %d]%s\n", ansiDim, cmd.ExitCode, ansiReset))
+	}
+	ac.time += asciicastPause
+}
+
+// file shows the contents of a fixture file, as if it had been opened in a
+// pager.
+func (ac *asciicastWriter) file(file *File) {
+	content := file.Content
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	ac.output(ansiDim + "# " + file.Path + ansiReset + "\n" + content)
+	ac.time += asciicastPause
+}
+
+// roundTime avoids floating point noise in event timestamps.
+func roundTime(t float64) float64 {
+	return float64(int64(t*1000+0.5)) / 1000
+}
@@ -0,0 +1,166 @@
+// Package export renders transcripts in formats meant for reading, such as
+// documentation and terminal recordings.
+package export
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/deref/transcript/internal/core"
+)
+
+// Transcript is a parsed transcript: a sequence of comments and commands.
+type Transcript struct {
+	Items []Item
+}
+
+// Item is either a comment line, a command, or a fixture file.
+type Item struct {
+	// Comment is the text of a comment, without its leading "#". Blank lines
+	// are comments with IsBlank set.
+	Comment string
+	IsBlank bool
+
+	Command *Command
+	File    *File
+}
+
+type Command struct {
+	Text     string // May span several lines.
+	Output   []Output
+	ExitCode int
+}
+
+// File is a fixture file written by a `% file` directive.
+type File struct {
+	Path    string
+	Content string
+}
+
+// Output is a piece of a command's output on one stream: either text, or a
+// reference to a file holding the output.
+type Output struct {
+	FD   int
+	Text string
+	File string
+}
+
+// Parse reads a transcript without running it.
+func Parse(ctx context.Context, r io.Reader) (*Transcript, error) {
+	h := &parseHandler{}
+	interp := &core.Interpreter{Handler: h}
+	if err := interp.ExecTranscript(ctx, r); err != nil {
+		return nil, err
+	}
+	return &h.transcript, nil
+}
+
+type parseHandler struct {
+	transcript Transcript
+	current    *Command
+}
+
+func (h *parseHandler) HandleComment(ctx context.Context, text string) error {
+	trimmed := strings.TrimSpace(text)
+	if trimmed == "" {
+		h.transcript.Items = append(h.transcript.Items, Item{IsBlank: true})
+		return nil
+	}
+	comment := strings.TrimPrefix(trimmed, "#")
+	comment = strings.TrimPrefix(comment, " ")
+	h.transcript.Items = append(h.transcript.Items, Item{Comment: comment})
+	return nil
+}
+
+func (h *parseHandler) HandleRun(ctx context.Context, command string) error {
+	h.current = &Command{Text: command}
+	h.transcript.Items = append(h.transcript.Items, Item{Command: h.current})
+	return nil
+}
+
+func (h *parseHandler) HandleOutput(ctx context.Context, fd int, line string) error {
+	h.appendOutput(Output{FD: fd, Text: line + "\n"})
+	return nil
+}
+
+func (h *parseHandler) HandleFileOutput(ctx context.Context, fd int, filepath string) error {
+	h.appendOutput(Output{FD: fd, File: filepath})
+	return nil
+}
+
+// appendOutput adds output to the current command, merging consecutive text
+// on the same stream.
+func (h *parseHandler) appendOutput(out Output) {
+	cmd := h.current
+	if n := len(cmd.Output); n > 0 && out.File == "" {
+		last := &cmd.Output[n-1]
+		if last.FD == out.FD && last.File == "" {
+			last.Text += out.Text
+			return
+		}
+	}
+	cmd.Output = append(cmd.Output, out)
+}
+
+func (h *parseHandler) HandleNoNewline(ctx context.Context, fd int) error {
+	cmd := h.current
+	for i := len(cmd.Output) - 1; i >= 0; i-- {
+		if out := &cmd.Output[i]; out.FD == fd && out.File == "" {
+			out.Text = strings.TrimSuffix(out.Text, "\n")
+			break
+		}
+	}
+	return nil
+}
+
+func (h *parseHandler) HandleDep(ctx context.Context, payload string) error {
+	return nil
+}
+
+func (h *parseHandler) HandleExternalize(ctx context.Context, limit core.ExternalizeLimit) error {
+	return nil
+}
+
+func (h *parseHandler) HandleFile(ctx context.Context, path string, content []byte) error {
+	file := &File{Path: path, Content: string(content)}
+	h.transcript.Items = append(h.transcript.Items, Item{File: file})
+	return nil
+}
+
+func (h *parseHandler) HandleDirective(ctx context.Context, name string, args string) error {
+	// Custom directives are not rendered.
+	return nil
+}
+
+func (h *parseHandler) HandleExitCode(ctx context.Context, exitCode int) error {
+	h.current.ExitCode = exitCode
+	return nil
+}
+
+func (h *parseHandler) HandleEnd(ctx context.Context) error {
+	return nil
+}
+
+// Options configures rendering.
+type Options struct {
+	// Title of the rendered document, if any.
+	Title string
+	// If provided, maps a file referenced by the transcript to the link used
+	// for it in the rendered output.
+	Link func(file string) string
+}
+
+func (opts Options) link(file string) string {
+	if opts.Link != nil {
+		return opts.Link(file)
+	}
+	return file
+}
+
+func streamName(fd int) string {
+	if fd == 2 {
+		return "stderr"
+	}
+	return "stdout"
+}
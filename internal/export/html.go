@@ -0,0 +1,89 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+)
+
+const htmlStyle = `body { font-family: sans-serif; max-width: 50em; margin: 2em auto; }
+pre.command { background: #1e1e1e; color: #d4d4d4; padding: 1em; overflow-x: auto; }
+.prompt { color: #6a9955; user-select: none; }
+.input { color: #ffffff; font-weight: bold; }
+.stderr { color: #f48771; }
+.exit-code { color: #808080; }
+pre.file { background: #f5f5f5; padding: 1em; overflow-x: auto; }
+`
+
+// HTML renders a transcript as a standalone HTML page. Comments become
+// paragraphs, and each command becomes a preformatted block in which stdout
+// and stderr are styled differently.
+func HTML(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+	title := opts.Title
+	if title == "" {
+		title = "Transcript"
+	}
+	fmt.Fprintf(bw, "<!DOCTYPE html>\n<html>\n<head>\n<meta charset=\"utf-8\">\n<title>%s</title>\n<style>\n%s</style>\n</head>\n<body>\n",
+		html.EscapeString(title), htmlStyle)
+	if opts.Title != "" {
+		fmt.Fprintf(bw, "<h1>%s</h1>\n", html.EscapeString(opts.Title))
+	}
+
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			fmt.Fprintf(bw, "<p>%s</p>\n", html.EscapeString(strings.Join(paragraph, "\n")))
+			paragraph = nil
+		}
+	}
+	for _, item := range t.Items {
+		switch {
+		case item.Command != nil:
+			flush()
+			htmlCommand(bw, item.Command, opts)
+		case item.File != nil:
+			flush()
+			fmt.Fprintf(bw, "<p><code>%s</code>:</p>\n<pre class=\"file\">%s</pre>\n",
+				html.EscapeString(item.File.Path), html.EscapeString(item.File.Content))
+		case item.IsBlank:
+			flush()
+		default:
+			paragraph = append(paragraph, item.Comment)
+		}
+	}
+	flush()
+
+	io.WriteString(bw, "</body>\n</html>\n")
+	return bw.Flush()
+}
+
+func htmlCommand(w io.Writer, cmd *Command, opts Options) {
+	io.WriteString(w, `<pre class="command">`)
+	for i, line := range strings.Split(cmd.Text, "\n") {
+		prompt := "$"
+		if i > 0 {
+			prompt = ">"
+		}
+		fmt.Fprintf(w, "<span class=\"prompt\">%s </span><span class=\"input\">%s</span>\n", prompt, html.EscapeString(line))
+	}
+	for _, out := range cmd.Output {
+		class := streamName(out.FD)
+		if out.File != "" {
+			fmt.Fprintf(w, "<span class=\"%s\">[%s: <a href=\"%s\">%s</a>]</span>\n",
+				class, class, html.EscapeString(opts.link(out.File)), html.EscapeString(out.File))
+			continue
+		}
+		text := out.Text
+		if !strings.HasSuffix(text, "\n") {
+			text += "\n"
+		}
+		fmt.Fprintf(w, "<span class=\"%s\">%s</span>", class, html.EscapeString(text))
+	}
+	if cmd.ExitCode != 0 {
+		fmt.Fprintf(w, "<span class=\"exit-code\">[exit status %d]</span>\n", cmd.ExitCode)
+	}
+	io.WriteString(w, "</pre>\n")
+}
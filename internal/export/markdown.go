@@ -0,0 +1,111 @@
+package export
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Markdown renders a transcript as Markdown. Comments become prose, and each
+// command becomes a console code block, followed by notes for its exit code
+// and any output saved to files.
+func Markdown(w io.Writer, t *Transcript, opts Options) error {
+	bw := bufio.NewWriter(w)
+	mw := &markdownWriter{w: bw}
+	if opts.Title != "" {
+		mw.chunk("# " + opts.Title + "\n")
+	}
+	var paragraph strings.Builder
+	flush := func() {
+		if paragraph.Len() > 0 {
+			mw.chunk(paragraph.String())
+			paragraph.Reset()
+		}
+	}
+	for _, item := range t.Items {
+		switch {
+		case item.Command != nil:
+			flush()
+			mw.command(item.Command, opts)
+		case item.File != nil:
+			flush()
+			mw.file(item.File)
+		case item.IsBlank:
+			flush()
+		default:
+			paragraph.WriteString(item.Comment + "\n")
+		}
+	}
+	flush()
+	return bw.Flush()
+}
+
+type markdownWriter struct {
+	w       io.Writer
+	started bool
+}
+
+// chunk writes a block of Markdown, separated from the previous one by a
+// blank line.
+func (mw *markdownWriter) chunk(text string) {
+	if mw.started {
+		io.WriteString(mw.w, "\n")
+	}
+	mw.started = true
+	io.WriteString(mw.w, text)
+}
+
+func (mw *markdownWriter) command(cmd *Command, opts Options) {
+	var code strings.Builder
+	lines := strings.Split(cmd.Text, "\n")
+	fmt.Fprintf(&code, "$ %s\n", lines[0])
+	for _, line := range lines[1:] {
+		fmt.Fprintf(&code, "> %s\n", line)
+	}
+	var notes []string
+	for _, out := range cmd.Output {
+		if out.File != "" {
+			notes = append(notes, fmt.Sprintf("%s: [%s](%s)", streamName(out.FD), out.File, opts.link(out.File)))
+			continue
+		}
+		code.WriteString(out.Text)
+		if !strings.HasSuffix(out.Text, "\n") {
+			code.WriteString("\n")
+		}
+	}
+	if cmd.ExitCode != 0 {
+		notes = append(notes, fmt.Sprintf("exit status %d", cmd.ExitCode))
+	}
+
+	fence := markdownFence(code.String())
+	mw.chunk(fence + "console\n" + code.String() + fence + "\n")
+	if len(notes) > 0 {
+		mw.chunk("_" + strings.Join(notes, "; ") + "_\n")
+	}
+}
+
+func (mw *markdownWriter) file(file *File) {
+	content := file.Content
+	if content != "" && !strings.HasSuffix(content, "\n") {
+		content += "\n"
+	}
+	fence := markdownFence(content)
+	mw.chunk("`" + file.Path + "`:\n")
+	mw.chunk(fence + "\n" + content + fence + "\n")
+}
+
+// markdownFence returns a code fence longer than any run of backticks in
+// text.
+func markdownFence(text string) string {
+	longest, run := 0, 0
+	for _, ch := range text {
+		if ch == '`' {
+			run++
+			longest = max(longest, run)
+		} else {
+			run = 0
+		}
+	}
+	return strings.Repeat("`", max(3, longest+1))
+}
@@ -0,0 +1,219 @@
+// Package gengo generates Go test files that check transcripts.
+package gengo
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+
+	"github.com/deref/transcript/internal/core"
+)
+
+// Options configures generation.
+type Options struct {
+	// Package of the generated file. If empty, the package of the Go files in
+	// the root directory is used.
+	Package string
+	// Command line to mention in the generated file's header.
+	Command string
+}
+
+// Test is a generated test function for a transcript.
+type Test struct {
+	Name string
+	// Path of the transcript, relative to the root directory.
+	Path string
+	// Working directory of the transcript, relative to the root directory.
+	Dir string
+	// Files the transcript references, relative to Dir.
+	Deps []string
+}
+
+// Find returns a test for each transcript in the tree rooted at root whose
+// file name matches pattern, in lexical order. Directories named testdata are
+// included, but hidden directories, those starting with "_", and vendor
+// directories are not.
+func Find(root, pattern string) ([]Test, error) {
+	if _, err := path.Match(pattern, ""); err != nil {
+		return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	var tests []Test
+	used := make(map[string]bool)    // Test names taken so far.
+	suffixes := make(map[string]int) // Last suffix tried, by base name.
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			name := d.Name()
+			if p != root && (strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_") || name == "vendor") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if ok, _ := path.Match(pattern, d.Name()); !ok {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		base := testName(rel)
+		test := Test{
+			Name: base,
+			Path: rel,
+			Dir:  path.Dir(rel),
+		}
+		for used[test.Name] {
+			suffixes[base]++
+			test.Name = base + strconv.Itoa(suffixes[base]+1)
+		}
+		used[test.Name] = true
+		test.Deps, err = staticDeps(p)
+		if err != nil {
+			return fmt.Errorf("%s: %w", p, err)
+		}
+		tests = append(tests, test)
+		return nil
+	})
+	return tests, err
+}
+
+// staticDeps returns the files referenced by the transcript at p, relative to
+// its directory.
+func staticDeps(p string) ([]string, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	deps, err := core.StaticDeps(filepath.Dir(p), f)
+	if err != nil {
+		return nil, err
+	}
+	var rels []string
+	seen := make(map[string]bool)
+	for _, dep := range deps {
+		rel, err := filepath.Rel(filepath.Dir(p), dep)
+		if err != nil {
+			rel = dep
+		}
+		rel = filepath.ToSlash(rel)
+		if !seen[rel] {
+			seen[rel] = true
+			rels = append(rels, rel)
+		}
+	}
+	return rels, nil
+}
+
+// testName derives a test function name from the path of a transcript, such
+// as TestTranscriptBasicOutput for "tests/basic-output/test.cmdt". The
+// conventional "test.cmdt" file name and "tests" or "testdata" directory are
+// left out.
+func testName(rel string) string {
+	parts := strings.Split(strings.TrimSuffix(rel, path.Ext(rel)), "/")
+	if len(parts) > 1 && parts[len(parts)-1] == "test" {
+		parts = parts[:len(parts)-1]
+	}
+	if len(parts) > 1 && (parts[0] == "tests" || parts[0] == "testdata") {
+		parts = parts[1:]
+	}
+	var sb strings.Builder
+	sb.WriteString("TestTranscript")
+	upper := true
+	for _, r := range strings.Join(parts, "/") {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+// PackageName returns the name of the package in dir, preferring non-test
+// files.
+func PackageName(dir string) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	var testPkg string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || filepath.Ext(name) != ".go" {
+			continue
+		}
+		f, err := parser.ParseFile(token.NewFileSet(), filepath.Join(dir, name), nil, parser.PackageClauseOnly)
+		if err != nil {
+			continue
+		}
+		pkg := f.Name.Name
+		if !strings.HasSuffix(name, "_test.go") {
+			return pkg, nil
+		}
+		if testPkg == "" {
+			testPkg = strings.TrimSuffix(pkg, "_test")
+		}
+	}
+	if testPkg != "" {
+		return testPkg, nil
+	}
+	return "", fmt.Errorf("no Go files in %s; use --package", dir)
+}
+
+var fileTemplate = template.Must(template.New("").Funcs(template.FuncMap{
+	"quote": strconv.Quote,
+}).Parse(`// Code generated by {{.Command}}; DO NOT EDIT.
+
+package {{.Package}}
+
+import (
+	"testing"
+
+	"github.com/deref/transcript/cmdtest"
+)
+{{range .Tests}}
+func {{.Name}}(t *testing.T) {
+	cmdtest.CheckFile(t, {{quote .Path}},
+		cmdtest.Dir({{quote .Dir}}),
+{{- if .Deps}}
+		cmdtest.Dep({{range $i, $dep := .Deps}}{{if $i}}, {{end}}{{quote $dep}}{{end}}),
+{{- end}}
+	)
+}
+{{end}}`))
+
+// Generate returns the source of a Go test file that checks tests.
+func Generate(tests []Test, opts Options) ([]byte, error) {
+	command := opts.Command
+	if command == "" {
+		command = "transcript gen-go"
+	}
+	var buf bytes.Buffer
+	err := fileTemplate.Execute(&buf, struct {
+		Command string
+		Package string
+		Tests   []Test
+	}{command, opts.Package, tests})
+	if err != nil {
+		return nil, err
+	}
+	return format.Source(buf.Bytes())
+}
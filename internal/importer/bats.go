@@ -0,0 +1,363 @@
+package importer
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"mvdan.cc/sh/v3/syntax"
+)
+
+// batsTestPattern matches the line that begins a test, which isn't valid
+// shell syntax until bats preprocesses it into a function declaration.
+var batsTestPattern = regexp.MustCompile(`^(\s*)@test\s+("(?:[^"\\]|\\.)*"|'[^']*')\s*\{\s*$`)
+
+// Bats converts a bats test file. Each test becomes a commented section, with
+// its setup and teardown functions inlined. The output and exit status checks
+// that follow `run` are translated to expectations on the command it runs.
+//
+// Like `run`, the transcript merges stderr into stdout. Checks that can't be
+// expressed as exact expectations, such as partial output matches, are
+// flagged.
+func Bats(name string, r io.Reader) (*Result, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Replace test declarations with functions, noting their names.
+	lines := strings.Split(string(data), "\n")
+	testNames := make(map[string]string)
+	for i, line := range lines {
+		m := batsTestPattern.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		testName := m[2][1 : len(m[2])-1]
+		if m[2][0] == '"' {
+			if unquoted, err := strconv.Unquote(m[2]); err == nil {
+				testName = unquoted
+			}
+		}
+		fn := fmt.Sprintf("bats_test_%d", i+1)
+		testNames[fn] = testName
+		lines[i] = m[1] + fn + "() {"
+	}
+	source := strings.Join(lines, "\n")
+
+	parser := syntax.NewParser(syntax.KeepComments(true), syntax.Variant(syntax.LangBash))
+	f, err := parser.Parse(strings.NewReader(source), name)
+	if err != nil {
+		return nil, err
+	}
+
+	bc := &batsConverter{
+		w:      &cmdtWriter{name: name},
+		source: source,
+		hooks:  make(map[string]*syntax.Block),
+	}
+	w := bc.w
+	w.command("exec 2>&1")
+	w.command(fmt.Sprintf(`export BATS_TEST_DIRNAME="$PWD" BATS_TEST_FILENAME="$PWD"/%s`, shellQuote(filepath.Base(name))))
+
+	// Hooks may be declared anywhere, but run around every test.
+	var tests, other []*syntax.Stmt
+	for _, stmt := range f.Stmts {
+		if decl, ok := stmt.Cmd.(*syntax.FuncDecl); ok {
+			switch fn := decl.Name.Value; fn {
+			case "setup", "teardown", "setup_file", "teardown_file":
+				if block, ok := decl.Body.Cmd.(*syntax.Block); ok {
+					bc.hooks[fn] = block
+					continue
+				}
+			default:
+				if _, ok := testNames[fn]; ok {
+					tests = append(tests, stmt)
+					continue
+				}
+			}
+		}
+		other = append(other, stmt)
+	}
+
+	for _, stmt := range other {
+		bc.comments(stmt.Comments, stmt.Pos())
+		bc.topLevel(stmt)
+	}
+	bc.hook("setup_file")
+	for _, stmt := range tests {
+		decl := stmt.Cmd.(*syntax.FuncDecl)
+		w.comment("")
+		bc.comments(stmt.Comments, stmt.Pos())
+		w.comment("# " + testNames[decl.Name.Value])
+		bc.hook("setup")
+		if block, ok := decl.Body.Cmd.(*syntax.Block); ok {
+			bc.block(block)
+		}
+		bc.hook("teardown")
+	}
+	bc.hook("teardown_file")
+	bc.comments(f.Last, syntax.Pos{})
+	return w.result(), nil
+}
+
+type batsConverter struct {
+	w      *cmdtWriter
+	source string
+	hooks  map[string]*syntax.Block
+	ran    bool // Whether the last command written was run with `run`.
+}
+
+// hook inlines the body of a setup or teardown function.
+func (bc *batsConverter) hook(name string) {
+	if block, ok := bc.hooks[name]; ok {
+		bc.block(block)
+	}
+}
+
+func (bc *batsConverter) block(block *syntax.Block) {
+	for _, stmt := range block.Stmts {
+		bc.comments(stmt.Comments, stmt.Pos())
+		bc.stmt(stmt)
+	}
+	bc.comments(block.Last, syntax.Pos{})
+}
+
+// comments writes the comments that come before pos, or all of them if pos
+// is not valid.
+func (bc *batsConverter) comments(comments []syntax.Comment, pos syntax.Pos) {
+	for _, c := range comments {
+		if pos.IsValid() && c.Pos().Offset() > pos.Offset() {
+			continue
+		}
+		bc.w.comment("# " + strings.TrimSpace(c.Text))
+	}
+}
+
+func (bc *batsConverter) text(node syntax.Node) string {
+	return bc.source[node.Pos().Offset():node.End().Offset()]
+}
+
+// words returns the source text of a command's name and arguments.
+func (bc *batsConverter) words(name string, args []*syntax.Word) string {
+	if len(args) == 0 {
+		return name
+	}
+	text := name + " " + bc.source[args[0].Pos().Offset():args[len(args)-1].End().Offset()]
+	if name == "[" {
+		text += " ]"
+	}
+	return text
+}
+
+func (bc *batsConverter) topLevel(stmt *syntax.Stmt) {
+	if call, ok := stmt.Cmd.(*syntax.CallExpr); ok && len(call.Args) > 0 {
+		if name, _ := batsLiteral(call.Args[0]); name == "load" || name == "bats_load_library" {
+			bc.w.skipf(int(stmt.Pos().Line()), "helper library not loaded: %s", bc.text(stmt))
+			return
+		}
+	}
+	bc.w.command(bc.text(stmt))
+	bc.ran = false
+}
+
+func (bc *batsConverter) stmt(stmt *syntax.Stmt) {
+	w := bc.w
+	lineno := int(stmt.Pos().Line())
+	call, ok := stmt.Cmd.(*syntax.CallExpr)
+	if !ok || len(call.Args) == 0 || stmt.Negated || stmt.Background {
+		w.command(bc.text(stmt))
+		bc.ran = false
+		return
+	}
+	name, _ := batsLiteral(call.Args[0])
+	args := call.Args[1:]
+
+	switch name {
+	case "run":
+		exitCode := 0
+		for len(args) > 0 {
+			flag, _ := batsLiteral(args[0])
+			if flag == "!" {
+				exitCode = 1
+				defer w.warnf(lineno, "expected failure; exit status assumed to be 1")
+			} else if n, err := strconv.Atoi(strings.TrimPrefix(flag, "-")); err == nil && strings.HasPrefix(flag, "-") {
+				exitCode = n
+			} else if strings.HasPrefix(flag, "--") {
+				defer w.warnf(lineno, "run option ignored: %s", flag)
+			} else {
+				break
+			}
+			args = args[1:]
+		}
+		if len(args) == 0 {
+			w.skipf(lineno, "run without a command")
+			return
+		}
+		w.command(bc.source[args[0].Pos().Offset():stmt.End().Offset()])
+		w.exitCode(exitCode)
+		bc.ran = true
+		return
+
+	case "[", "test":
+		if bc.testAssertion(lineno, name, args) {
+			return
+		}
+
+	case "assert_success", "refute_output":
+		if len(args) == 0 && bc.ran {
+			return
+		}
+
+	case "assert_failure":
+		if bc.ran {
+			if len(args) == 0 {
+				w.exitCode(1)
+				w.warnf(lineno, "expected failure; exit status assumed to be 1")
+				return
+			}
+			if code, ok := batsLiteral(args[0]); ok {
+				if n, err := strconv.Atoi(code); err == nil {
+					w.exitCode(n)
+					return
+				}
+			}
+		}
+
+	case "assert_output":
+		if len(args) == 1 && bc.ran {
+			if text, ok := batsLiteral(args[0]); ok && !strings.HasPrefix(text, "-") {
+				bc.expectOutput(text)
+				return
+			}
+		}
+
+	case "skip":
+		w.skipf(lineno, "skip ignored: %s", bc.text(stmt))
+		return
+	}
+
+	if isBatsAssertion(name) {
+		w.warnf(lineno, "assertion not translated: %s", bc.text(stmt))
+		return
+	}
+	w.command(bc.text(stmt))
+	bc.ran = false
+}
+
+// testAssertion translates a `[ ... ]` check of the status or output of the
+// last `run`, reporting whether it did so.
+func (bc *batsConverter) testAssertion(lineno int, name string, args []*syntax.Word) bool {
+	if name == "[" {
+		if len(args) == 0 {
+			return false
+		}
+		if end, _ := batsLiteral(args[len(args)-1]); end != "]" {
+			return false
+		}
+		args = args[:len(args)-1]
+	}
+	var operands []string
+	var vars []string
+	for _, arg := range args {
+		if v, ok := batsVariable(arg); ok {
+			vars = append(vars, v)
+			operands = append(operands, "$"+v)
+			continue
+		}
+		lit, ok := batsLiteral(arg)
+		if !ok {
+			operands = append(operands, "")
+			continue
+		}
+		operands = append(operands, lit)
+	}
+	if len(vars) != 1 || (vars[0] != "status" && vars[0] != "output" && !strings.HasPrefix(vars[0], "lines")) {
+		return false
+	}
+	if !bc.ran {
+		bc.w.warnf(lineno, "check does not follow run: %s", bc.words(name, args))
+		return true
+	}
+
+	switch {
+	case len(operands) == 3 && operands[0] == "$status" && (operands[1] == "-eq" || operands[1] == "=" || operands[1] == "=="):
+		if n, err := strconv.Atoi(operands[2]); err == nil {
+			bc.w.exitCode(n)
+			return true
+		}
+	case len(operands) == 3 && operands[0] == "$output" && (operands[1] == "=" || operands[1] == "=="):
+		if _, ok := batsLiteral(args[2]); ok {
+			bc.expectOutput(operands[2])
+			return true
+		}
+	case len(operands) == 2 && operands[0] == "-z" && operands[1] == "$output":
+		return true
+	}
+	bc.w.warnf(lineno, "check not translated: %s", bc.words(name, args))
+	return true
+}
+
+// expectOutput expects the output of the last run. Like command
+// substitution, `run` strips the trailing newline from $output.
+func (bc *batsConverter) expectOutput(text string) {
+	if text != "" {
+		bc.w.output(1, text+"\n")
+	}
+}
+
+func isBatsAssertion(name string) bool {
+	return strings.HasPrefix(name, "assert_") || strings.HasPrefix(name, "refute_") || name == "assert" || name == "refute"
+}
+
+// batsLiteral returns the value of a word without expansions.
+func batsLiteral(w *syntax.Word) (string, bool) {
+	var sb strings.Builder
+	for _, part := range w.Parts {
+		switch part := part.(type) {
+		case *syntax.Lit:
+			sb.WriteString(part.Value)
+		case *syntax.SglQuoted:
+			sb.WriteString(part.Value)
+		case *syntax.DblQuoted:
+			for _, part := range part.Parts {
+				lit, ok := part.(*syntax.Lit)
+				if !ok {
+					return "", false
+				}
+				sb.WriteString(lit.Value)
+			}
+		default:
+			return "", false
+		}
+	}
+	return sb.String(), true
+}
+
+// batsVariable returns the name of the variable that a word consists of,
+// such as "$output" or "${lines[0]}".
+func batsVariable(w *syntax.Word) (string, bool) {
+	parts := w.Parts
+	if len(parts) == 1 {
+		if dq, ok := parts[0].(*syntax.DblQuoted); ok {
+			parts = dq.Parts
+		}
+	}
+	if len(parts) != 1 {
+		return "", false
+	}
+	pe, ok := parts[0].(*syntax.ParamExp)
+	if !ok || pe.Param == nil {
+		return "", false
+	}
+	if pe.Index != nil {
+		return pe.Param.Value + "[]", true
+	}
+	if pe.Exp != nil || pe.Repl != nil || pe.Slice != nil || pe.Length {
+		return "", false
+	}
+	return pe.Param.Value, true
+}
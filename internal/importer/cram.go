@@ -0,0 +1,103 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cram converts a cram test (*.t). Indented `$ ` and `> ` lines are commands,
+// the indented lines following them are expected output, and everything else
+// is prose, which becomes comments.
+//
+// Like cram, the transcript runs in a temporary directory with stderr merged
+// into stdout, and with TESTDIR, TESTFILE and TESTTMP set. Regular expression
+// and glob output lines have no equivalent, so they are kept literally and
+// flagged.
+func Cram(name string, r io.Reader) (*Result, error) {
+	w := &cmdtWriter{name: name}
+	w.command("exec 2>&1")
+	w.command(fmt.Sprintf(`export TESTDIR="$PWD" TESTFILE=%s TESTTMP="$(mktemp -d)"`, shellQuote(filepath.Base(name))))
+	w.command(`cd "$TESTTMP"`)
+
+	scanner := bufio.NewScanner(r)
+	lineno := 0
+	var command *string // Text of the command being read, until its output begins.
+	inCommand := false  // Whether output lines belong to a command.
+	for scanner.Scan() {
+		lineno++
+		line := scanner.Text()
+		indented, isIndented := strings.CutPrefix(line, "  ")
+
+		switch {
+		case isIndented && strings.HasPrefix(indented, "$ "):
+			w.flush()
+			text := indented[2:]
+			command = &text
+			inCommand = true
+
+		case isIndented && command != nil && strings.HasPrefix(indented, "> "):
+			*command += "\n" + indented[2:]
+
+		case isIndented && inCommand:
+			if command != nil {
+				w.command(*command)
+				command = nil
+			}
+			cramOutput(w, lineno, indented)
+
+		default:
+			if command != nil {
+				w.command(*command)
+				command = nil
+			}
+			inCommand = false
+			if strings.TrimSpace(line) == "" {
+				w.comment("")
+			} else {
+				w.comment("# " + line)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if command != nil {
+		w.command(*command)
+	}
+	return w.result(), nil
+}
+
+// cramOutput translates an expected output line.
+func cramOutput(w *cmdtWriter, lineno int, line string) {
+	if code, ok := strings.CutPrefix(line, "["); ok {
+		if code, ok := strings.CutSuffix(code, "]"); ok {
+			if n, err := strconv.Atoi(code); err == nil {
+				w.exitCode(n)
+				return
+			}
+		}
+	}
+
+	eol := "\n"
+	if text, ok := strings.CutSuffix(line, " (no-eol)"); ok {
+		line, eol = text, ""
+	}
+	switch {
+	case strings.HasSuffix(line, " (re)"):
+		w.warnf(lineno, "regular expression output line kept literally: %s", line)
+	case strings.HasSuffix(line, " (glob)"):
+		w.warnf(lineno, "glob output line kept literally: %s", line)
+	case strings.HasSuffix(line, " (esc)"):
+		text, err := strconv.Unquote(`"` + strings.ReplaceAll(strings.TrimSuffix(line, " (esc)"), `"`, `\"`) + `"`)
+		if err != nil || strings.ContainsAny(text, "\x00\r") {
+			w.warnf(lineno, "escaped output line kept literally: %s", line)
+		} else {
+			line = text
+		}
+	}
+	w.output(1, line+eol)
+}
@@ -0,0 +1,242 @@
+// Package importer converts tests written for other command-line testing
+// tools into transcripts.
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Converter converts a test file in some other format to a transcript. The
+// name is used in warnings.
+type Converter func(name string, r io.Reader) (*Result, error)
+
+// Converters are the supported source formats, by name.
+var Converters = map[string]Converter{
+	"cram":       Cram,
+	"testscript": Testscript,
+	"bats":       Bats,
+}
+
+// Formats returns the names of the supported source formats.
+func Formats() []string {
+	formats := make([]string, 0, len(Converters))
+	for name := range Converters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return formats
+}
+
+// Result is a converted transcript.
+type Result struct {
+	Transcript []byte
+	// Warnings describe constructs that could not be translated faithfully.
+	// Each is also left in the transcript as a comment starting with
+	// WarningPrefix, next to the command it concerns.
+	Warnings []Warning
+}
+
+// WarningPrefix starts the comments left in converted transcripts for
+// constructs that could not be translated.
+const WarningPrefix = "# import: "
+
+// Warning is a construct that could not be translated faithfully.
+type Warning struct {
+	Name    string
+	Lineno  int
+	Message string
+}
+
+func (w Warning) String() string {
+	return fmt.Sprintf("%s:%d: %s", w.Name, w.Lineno, w.Message)
+}
+
+// cmdtWriter builds a transcript one command at a time. Expectations and
+// warnings accumulate on a pending command until the next one begins, so that
+// warnings can be written as comments above the command they concern.
+type cmdtWriter struct {
+	name     string
+	buf      bytes.Buffer
+	warnings []Warning
+	pending  *pendingCommand
+	afterCmd bool // Whether the last thing written was a command.
+}
+
+type pendingCommand struct {
+	text     string
+	notes    []string
+	output   []outputLine
+	exitCode int
+}
+
+type outputLine struct {
+	fd   int
+	text string // Without trailing newline.
+	file string // For `1<` / `2<` references.
+	eol  bool   // Whether the line ends with a newline.
+}
+
+// comment writes a comment (or blank line, for empty text) as-is.
+func (w *cmdtWriter) comment(text string) {
+	w.flush()
+	if w.afterCmd && text != "" {
+		w.buf.WriteString("\n")
+	}
+	w.buf.WriteString(strings.TrimRight(text, " \t") + "\n")
+	w.afterCmd = false
+}
+
+// command begins a new command, which may span multiple lines.
+func (w *cmdtWriter) command(text string) {
+	w.flush()
+	w.pending = &pendingCommand{text: text}
+}
+
+// output expects text on fd. Text not ending in a newline is expected
+// without one.
+func (w *cmdtWriter) output(fd int, text string) {
+	cmd := w.current()
+	for len(text) > 0 {
+		line, rest, eol := strings.Cut(text, "\n")
+		cmd.output = append(cmd.output, outputLine{fd: fd, text: line, eol: eol})
+		text = rest
+	}
+}
+
+// fileOutput expects the contents of a file on fd.
+func (w *cmdtWriter) fileOutput(fd int, file string) {
+	cmd := w.current()
+	cmd.output = append(cmd.output, outputLine{fd: fd, file: file, eol: true})
+}
+
+func (w *cmdtWriter) exitCode(code int) {
+	w.current().exitCode = code
+}
+
+// warnf records a construct that could not be translated, and notes it above
+// the current command, or in place if there is none.
+func (w *cmdtWriter) warnf(lineno int, format string, v ...any) {
+	msg := fmt.Sprintf(format, v...)
+	w.warnings = append(w.warnings, Warning{Name: w.name, Lineno: lineno, Message: msg})
+	if w.pending != nil {
+		w.pending.notes = append(w.pending.notes, msg)
+	} else {
+		w.comment(WarningPrefix + msg)
+	}
+}
+
+// skipf records a construct that was left out of the transcript, and notes
+// it in place.
+func (w *cmdtWriter) skipf(lineno int, format string, v ...any) {
+	w.flush()
+	w.warnf(lineno, format, v...)
+}
+
+// current returns the pending command, starting an empty one if necessary.
+// An empty command is never written, but its warnings are.
+func (w *cmdtWriter) current() *pendingCommand {
+	if w.pending == nil {
+		w.pending = &pendingCommand{}
+	}
+	return w.pending
+}
+
+func (w *cmdtWriter) flush() {
+	cmd := w.pending
+	if cmd == nil {
+		return
+	}
+	w.pending = nil
+	if w.afterCmd {
+		w.buf.WriteString("\n")
+	}
+	for _, note := range cmd.notes {
+		w.buf.WriteString(WarningPrefix + note + "\n")
+	}
+	if cmd.text == "" {
+		w.afterCmd = false
+		return
+	}
+	lines := strings.Split(cmd.text, "\n")
+	fmt.Fprintf(&w.buf, "$ %s\n", lines[0])
+	for _, line := range lines[1:] {
+		if line == "" {
+			w.buf.WriteString(">\n")
+		} else {
+			fmt.Fprintf(&w.buf, "> %s\n", line)
+		}
+	}
+	for _, out := range cmd.output {
+		switch {
+		case out.file != "":
+			fmt.Fprintf(&w.buf, "%d< %s\n", out.fd, out.file)
+		case out.text == "":
+			fmt.Fprintf(&w.buf, "%d\n", out.fd)
+		default:
+			fmt.Fprintf(&w.buf, "%d %s\n", out.fd, out.text)
+		}
+		if !out.eol {
+			w.buf.WriteString("% no-newline\n")
+		}
+	}
+	if cmd.exitCode != 0 {
+		fmt.Fprintf(&w.buf, "? %d\n", cmd.exitCode)
+	}
+	w.afterCmd = true
+}
+
+// fixture writes a `% file` directive that creates a file with the given
+// contents.
+func (w *cmdtWriter) fixture(name, contents string) {
+	w.flush()
+	if w.afterCmd {
+		w.buf.WriteString("\n")
+	}
+	fmt.Fprintf(&w.buf, "%% file %s\n", name)
+	for len(contents) > 0 {
+		line, rest, eol := strings.Cut(contents, "\n")
+		if line == "" {
+			w.buf.WriteString("|\n")
+		} else {
+			fmt.Fprintf(&w.buf, "| %s\n", line)
+		}
+		if !eol {
+			w.buf.WriteString("% no-newline\n")
+		}
+		contents = rest
+	}
+	w.afterCmd = true
+}
+
+func (w *cmdtWriter) result() *Result {
+	w.flush()
+	transcript := bytes.TrimRight(w.buf.Bytes(), "\n")
+	if len(transcript) > 0 {
+		transcript = append(transcript, '\n')
+	}
+	return &Result{
+		Transcript: transcript,
+		Warnings:   w.warnings,
+	}
+}
+
+func cutLast(s, sep string) (before, after string, found bool) {
+	if i := strings.LastIndex(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+	return s, "", false
+}
+
+// shellQuote quotes s for the shell, if necessary.
+func shellQuote(s string) string {
+	if s != "" && strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=+,:@%", r))
+	}) < 0 {
+		return s
+	}
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
@@ -0,0 +1,322 @@
+package importer
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Testscript converts a Go testscript archive (txtar). The archive's files are
+// created in a temporary directory, which the transcript runs in, and script
+// commands are translated to shell commands.
+//
+// Output assertions (stdout and stderr) are regular expressions, which have no
+// equivalent, so they are flagged. `cmp stdout file` is translated exactly, as
+// a file reference.
+func Testscript(name string, r io.Reader) (*Result, error) {
+	script, files, err := parseTxtar(r)
+	if err != nil {
+		return nil, err
+	}
+
+	w := &cmdtWriter{name: name}
+	w.command(`cd "$(mktemp -d)"`)
+	w.command(`export WORK="$PWD"`)
+	for _, file := range files {
+		w.fixture(file.name, file.data)
+	}
+
+	ts := &testscriptConverter{w: w}
+	for i, line := range script {
+		ts.line(i+1, line)
+	}
+	return w.result(), nil
+}
+
+type txtarFile struct {
+	name string
+	data string
+}
+
+// parseTxtar splits a txtar archive into the lines of its comment section,
+// which holds the script, and its files.
+func parseTxtar(r io.Reader) (script []string, files []txtarFile, err error) {
+	scanner := bufio.NewScanner(r)
+	var file *txtarFile
+	for scanner.Scan() {
+		line := scanner.Text()
+		if name, ok := txtarMarker(line); ok {
+			files = append(files, txtarFile{name: name})
+			file = &files[len(files)-1]
+			continue
+		}
+		if file == nil {
+			script = append(script, line)
+		} else {
+			file.data += line + "\n"
+		}
+	}
+	return script, files, scanner.Err()
+}
+
+func txtarMarker(line string) (name string, ok bool) {
+	if !strings.HasPrefix(line, "-- ") || !strings.HasSuffix(line, " --") || len(line) < 7 {
+		return "", false
+	}
+	name = strings.TrimSpace(line[3 : len(line)-3])
+	return name, name != ""
+}
+
+type testscriptConverter struct {
+	w     *cmdtWriter
+	stdin string // File to redirect the next exec's stdin from.
+}
+
+func (ts *testscriptConverter) line(lineno int, line string) {
+	w := ts.w
+	line = strings.TrimSpace(line)
+	if line == "" {
+		w.comment("")
+		return
+	}
+	if strings.HasPrefix(line, "#") {
+		w.comment(line)
+		return
+	}
+
+	// Conditions apply to the command that follows them.
+	var conds []string
+	for strings.HasPrefix(line, "[") {
+		end := strings.Index(line, "]")
+		if end < 0 {
+			break
+		}
+		conds = append(conds, line[:end+1])
+		line = strings.TrimSpace(line[end+1:])
+	}
+	neg, maybe := false, false
+	switch {
+	case strings.HasPrefix(line, "! "):
+		neg, line = true, strings.TrimSpace(line[2:])
+	case strings.HasPrefix(line, "? "):
+		maybe, line = true, strings.TrimSpace(line[2:])
+	}
+	background := false
+	if rest, ok := strings.CutSuffix(line, " &"); ok {
+		background, line = true, strings.TrimSpace(rest)
+	}
+
+	args := testscriptArgs(line)
+	if len(args) == 0 {
+		return
+	}
+	cmd, args := args[0].raw, args[1:]
+	if len(conds) > 0 && cmd != "skip" {
+		defer w.warnf(lineno, "condition %s ignored", strings.Join(conds, ""))
+	}
+	if background {
+		defer w.warnf(lineno, "background command run in the foreground")
+	}
+	if maybe {
+		defer w.warnf(lineno, "command may fail; exit status not checked")
+	}
+
+	switch cmd {
+	case "exec":
+		if len(args) == 0 {
+			w.skipf(lineno, "exec without a command")
+			return
+		}
+		text := shellWords(args)
+		if ts.stdin != "" {
+			text += " < " + shellQuote(ts.stdin)
+			ts.stdin = ""
+		}
+		w.command(text)
+		if neg {
+			w.exitCode(1)
+			w.warnf(lineno, "expected failure; exit status assumed to be 1")
+		}
+		return
+
+	case "stdout", "stderr":
+		if neg && len(args) == 1 && args[0].raw == "." {
+			// No output is expected, as in a transcript without output lines.
+			return
+		}
+		not := ""
+		if neg {
+			not = "not "
+		}
+		w.warnf(lineno, "%s should %smatch: %s", cmd, not, strings.Join(rawWords(args), " "))
+		return
+
+	case "cmp":
+		if len(args) == 2 && !neg && (args[0].raw == "stdout" || args[0].raw == "stderr") {
+			fd := 1
+			if args[0].raw == "stderr" {
+				fd = 2
+			}
+			w.fileOutput(fd, args[1].raw)
+			return
+		}
+		ts.command(neg, "diff "+shellWords(args))
+		return
+
+	case "stdin":
+		if len(args) == 1 && args[0].raw != "stdout" && args[0].raw != "stderr" {
+			ts.stdin = args[0].raw
+			return
+		}
+
+	case "env":
+		if len(args) > 0 && !neg {
+			w.command("export " + shellWords(args))
+			return
+		}
+
+	case "cd", "cp", "mv", "chmod":
+		ts.command(neg, cmd+" "+shellWords(args))
+		return
+
+	case "mkdir":
+		ts.command(neg, "mkdir -p "+shellWords(args))
+		return
+
+	case "rm":
+		ts.command(neg, "rm -rf "+shellWords(args))
+		return
+
+	case "symlink":
+		if len(args) == 3 && args[1].raw == "->" {
+			ts.command(neg, "ln -s "+shellWords(args[2:])+" "+shellWords(args[:1]))
+			return
+		}
+
+	case "exists":
+		var tests []string
+		for _, arg := range args {
+			if strings.HasPrefix(arg.raw, "-") {
+				continue
+			}
+			if neg {
+				tests = append(tests, "test ! -e "+shellWords([]testscriptWord{arg}))
+			} else {
+				tests = append(tests, "test -e "+shellWords([]testscriptWord{arg}))
+			}
+		}
+		if len(tests) > 0 {
+			w.command(strings.Join(tests, " && "))
+			return
+		}
+
+	case "grep":
+		if len(args) == 2 {
+			ts.command(neg, "grep -Eq "+shellWords(args))
+			return
+		}
+	}
+	w.skipf(lineno, "unsupported command: %s", line)
+}
+
+// command writes a translated command, which is expected to fail if neg.
+func (ts *testscriptConverter) command(neg bool, text string) {
+	ts.w.command(text)
+	if neg {
+		ts.w.exitCode(1)
+	}
+}
+
+// testscriptWord is an argument in a testscript command. Text in single quotes
+// is literal, and elsewhere $VAR and ${VAR} are expanded.
+type testscriptWord struct {
+	raw   string // As written, for messages.
+	parts []testscriptPart
+}
+
+type testscriptPart struct {
+	text   string
+	quoted bool
+}
+
+func testscriptArgs(line string) []testscriptWord {
+	var words []testscriptWord
+	var word *testscriptWord
+	for i := 0; i < len(line); {
+		ch := line[i]
+		if ch == ' ' || ch == '\t' {
+			word = nil
+			i++
+			continue
+		}
+		if word == nil {
+			words = append(words, testscriptWord{})
+			word = &words[len(words)-1]
+		}
+		start := i
+		if ch == '\'' {
+			// Quoted text ends at a lone quote; '' is a literal quote.
+			var sb strings.Builder
+			for i++; i < len(line); i++ {
+				if line[i] == '\'' {
+					if i+1 < len(line) && line[i+1] == '\'' {
+						sb.WriteByte('\'')
+						i++
+						continue
+					}
+					i++
+					break
+				}
+				sb.WriteByte(line[i])
+			}
+			word.parts = append(word.parts, testscriptPart{text: sb.String(), quoted: true})
+		} else {
+			for i < len(line) && line[i] != ' ' && line[i] != '\t' && line[i] != '\'' {
+				i++
+			}
+			word.parts = append(word.parts, testscriptPart{text: line[start:i]})
+		}
+		word.raw += line[start:i]
+	}
+	return words
+}
+
+// shellWords renders testscript words as shell words with the same meaning.
+func shellWords(words []testscriptWord) string {
+	rendered := make([]string, len(words))
+	for i, word := range words {
+		var sb strings.Builder
+		for _, part := range word.parts {
+			if part.quoted {
+				sb.WriteString(shellQuote(part.text))
+				continue
+			}
+			if isPlainWord(part.text) {
+				sb.WriteString(part.text)
+				continue
+			}
+			// Double quotes keep variable expansion.
+			escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "`", "\\`").Replace(part.text)
+			fmt.Fprintf(&sb, `"%s"`, escaped)
+		}
+		rendered[i] = sb.String()
+	}
+	return strings.Join(rendered, " ")
+}
+
+// isPlainWord reports whether s, including any variable references, can be
+// written in the shell without quoting.
+func isPlainWord(s string) bool {
+	return strings.IndexFunc(s, func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("-_./=+,:@%${}", r))
+	}) < 0
+}
+
+func rawWords(words []testscriptWord) []string {
+	raw := make([]string, len(words))
+	for i, word := range words {
+		raw[i] = word.raw
+	}
+	return raw
+}
@@ -0,0 +1,113 @@
+package interactive
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// metaCommand is a shell command that edits the transcript being recorded,
+// rather than being run and recorded itself.
+type metaCommand struct {
+	usage       string
+	description string
+	run         func(ctx context.Context, sh *Shell, args string) error
+}
+
+var metaCommands map[string]metaCommand
+
+func init() {
+	metaCommands = map[string]metaCommand{
+		"undo": {
+			usage:       ":undo",
+			description: "remove the last command from the transcript (its effects are not undone)",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				command, ok := sh.rec.Undo()
+				if !ok {
+					return fmt.Errorf("nothing to undo")
+				}
+				fmt.Fprintf(os.Stderr, "removed: $ %s\n", command)
+				return nil
+			},
+		},
+		"retry": {
+			usage:       ":retry",
+			description: "remove the last command from the transcript and run it again",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				command, ok := sh.rec.Undo()
+				if !ok {
+					return fmt.Errorf("nothing to retry")
+				}
+				return sh.runCommand(ctx, command)
+			},
+		},
+		"dep": {
+			usage:       ":dep <shell-args...>",
+			description: "declare dependencies with a % dep directive",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				if args == "" {
+					return fmt.Errorf("usage: :dep <shell-args...>")
+				}
+				if err := sh.rec.RunDepDirective(ctx, args); err != nil {
+					return fmt.Errorf("dep: %w", err)
+				}
+				sh.rec.RecordComment("% dep " + args)
+				return nil
+			},
+		},
+		"comment": {
+			usage:       ":comment <text>",
+			description: "record a comment",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				sh.rec.RecordComment(strings.TrimRight("# "+args, " "))
+				return nil
+			},
+		},
+		"show": {
+			usage:       ":show",
+			description: "print the transcript recorded so far",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				_, err := os.Stdout.Write(sh.rec.Transcript.Bytes())
+				return err
+			},
+		},
+		"save": {
+			usage:       ":save",
+			description: "write the transcript recorded so far to the output file",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				if err := sh.Save(); err != nil {
+					return err
+				}
+				fmt.Fprintf(os.Stderr, "saved: %s\n", sh.OutputPath)
+				return nil
+			},
+		},
+		"help": {
+			usage:       ":help",
+			description: "list meta-commands",
+			run: func(ctx context.Context, sh *Shell, args string) error {
+				for _, name := range []string{"undo", "retry", "dep", "comment", "show", "save", "help"} {
+					meta := metaCommands[name]
+					fmt.Fprintf(os.Stderr, "  %-22s %s\n", meta.usage, meta.description)
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// isMetaCommand reports whether a line of input is a meta-command, such as
+// ":undo". Note that ":" followed by a space is the shell's no-op builtin.
+func isMetaCommand(line string) bool {
+	return len(line) > 1 && line[0] == ':' && line[1] != ' ' && line[1] != '\t'
+}
+
+func (sh *Shell) runMetaCommand(ctx context.Context, line string) error {
+	name, args, _ := strings.Cut(line[1:], " ")
+	meta, ok := metaCommands[name]
+	if !ok {
+		return fmt.Errorf("unknown meta-command :%s (try :help)", name)
+	}
+	return meta.run(ctx, sh, strings.TrimSpace(args))
+}
@@ -0,0 +1,179 @@
+package interactive
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+
+	"github.com/deref/transcript/internal/core"
+)
+
+// Review walks through the commands whose expectations differ between a
+// transcript and a proposed update of it, asking whether to accept, reject or
+// skip each change.
+type Review struct {
+	In    io.Reader
+	Out   io.Writer
+	Color bool
+
+	scanner *bufio.Scanner
+	quit    bool
+}
+
+type ReviewResult struct {
+	// Transcript is the original transcript with accepted changes applied.
+	Transcript []byte
+	// Pending is the proposed update with rejected changes removed, or nil if
+	// no skipped changes remain.
+	Pending []byte
+
+	// Segments of the proposed update, grouped by decision.
+	Accepted []core.Segment
+	Rejected []core.Segment
+	Skipped  []core.Segment
+}
+
+// Quit reports whether the user asked to stop reviewing. Once quit, all
+// subsequent changes are skipped without prompting.
+func (rv *Review) Quit() bool {
+	return rv.quit
+}
+
+func (rv *Review) ReviewTranscript(filename string, original, pending []byte) (*ReviewResult, error) {
+	origSegs, err := core.SplitSegments(bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("reading transcript: %w", err)
+	}
+	pendSegs, err := core.SplitSegments(bytes.NewReader(pending))
+	if err != nil {
+		return nil, fmt.Errorf("reading pending update: %w", err)
+	}
+	origCmds := commandSegments(origSegs)
+	pendCmds := commandSegments(pendSegs)
+	if !sameCommands(origCmds, pendCmds) {
+		return nil, fmt.Errorf("pending update is out of date")
+	}
+
+	res := &ReviewResult{}
+	accepted := make([]bool, len(origCmds))
+	skipped := make([]bool, len(origCmds))
+	for i, orig := range origCmds {
+		pend := pendCmds[i]
+		if orig.String() == pend.String() {
+			continue
+		}
+		decision := 's'
+		if !rv.quit {
+			decision, err = rv.prompt(filename, orig, pend)
+			if err != nil {
+				return nil, err
+			}
+		}
+		switch decision {
+		case 'a':
+			accepted[i] = true
+			res.Accepted = append(res.Accepted, pend)
+		case 'r':
+			res.Rejected = append(res.Rejected, pend)
+		default:
+			skipped[i] = true
+			res.Skipped = append(res.Skipped, pend)
+		}
+	}
+
+	res.Transcript = mergeSegments(origSegs, pendCmds, accepted)
+	if len(res.Skipped) > 0 {
+		for i := range skipped {
+			skipped[i] = skipped[i] || accepted[i]
+		}
+		res.Pending = mergeSegments(origSegs, pendCmds, skipped)
+	}
+	return res, nil
+}
+
+func (rv *Review) prompt(filename string, orig, pend core.Segment) (rune, error) {
+	if rv.scanner == nil {
+		rv.scanner = bufio.NewScanner(rv.In)
+	}
+
+	fmt.Fprintf(rv.Out, "%s:%d\n", filename, orig.Lineno)
+	diffErr := core.DiffError{
+		Expected: orig.String(),
+		Actual:   pend.String(),
+	}
+	if rv.Color {
+		fmt.Fprint(rv.Out, diffErr.Color())
+	} else {
+		fmt.Fprint(rv.Out, diffErr.Plain())
+	}
+	for {
+		fmt.Fprint(rv.Out, "accept (a), reject (r), skip (s), quit (q)? ")
+		if !rv.scanner.Scan() {
+			if err := rv.scanner.Err(); err != nil {
+				return 0, fmt.Errorf("reading input: %w", err)
+			}
+			fmt.Fprintln(rv.Out)
+			rv.quit = true
+			return 's', nil
+		}
+		switch strings.TrimSpace(rv.scanner.Text()) {
+		case "a", "accept":
+			return 'a', nil
+		case "r", "reject":
+			return 'r', nil
+		case "s", "skip":
+			return 's', nil
+		case "q", "quit":
+			rv.quit = true
+			return 's', nil
+		}
+	}
+}
+
+func commandSegments(segs []core.Segment) []core.Segment {
+	var cmds []core.Segment
+	for _, seg := range segs {
+		if seg.Command {
+			cmds = append(cmds, seg)
+		}
+	}
+	return cmds
+}
+
+// sameCommands reports whether two lists of command segments run the same
+// commands, regardless of their expectations.
+func sameCommands(a, b []core.Segment) bool {
+	return slices.EqualFunc(a, b, func(a, b core.Segment) bool {
+		return slices.Equal(commandLines(a), commandLines(b))
+	})
+}
+
+func commandLines(seg core.Segment) []string {
+	var lines []string
+	for _, line := range seg.Lines {
+		if line == "$" || line == ">" || strings.HasPrefix(line, "$ ") || strings.HasPrefix(line, "> ") {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// mergeSegments reassembles a transcript from the original segments,
+// substituting the replacement for each command segment where use is true.
+func mergeSegments(segs []core.Segment, replacements []core.Segment, use []bool) []byte {
+	var buf bytes.Buffer
+	cmdIdx := 0
+	for _, seg := range segs {
+		if seg.Command {
+			if use[cmdIdx] {
+				seg = replacements[cmdIdx]
+			}
+			cmdIdx++
+		}
+		buf.WriteString(seg.String())
+	}
+	return buf.Bytes()
+}
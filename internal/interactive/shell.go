@@ -1,17 +1,30 @@
 package interactive
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/chzyer/readline"
 	"github.com/deref/transcript/internal/core"
+	"github.com/natefinch/atomic"
+	"mvdan.cc/sh/v3/syntax"
 )
 
 type Shell struct {
+	// Text output over this limit is written to a file and referenced.
+	Externalize core.ExternalizeLimit
+	// Where the transcript is written by Save.
+	OutputPath string
+	// If provided, this transcript is checked before the session begins, and
+	// recording continues from the end of it.
+	Append []byte
+
 	rec *core.Recorder
 	rl  *readline.Instance
 }
@@ -24,29 +37,87 @@ func (sh *Shell) Run(ctx context.Context) error {
 	}
 	defer sh.rl.Close()
 
+	stdout := &muteWriter{w: os.Stdout}
+	stderr := &muteWriter{w: os.Stderr}
 	sh.rec = &core.Recorder{
-		Stdout: os.Stdout,
-		Stderr: os.Stderr,
+		Stdout: stdout,
+		Stderr: stderr,
+
+		Externalize: sh.Externalize,
 	}
 	if err := sh.rec.Init(); err != nil {
 		return fmt.Errorf("initializing: %w", err)
 	}
 
+	if sh.Append != nil {
+		// Replay the existing transcript quietly to restore its shell state.
+		// Replaying never modifies files referenced by the transcript.
+		stdout.muted, stderr.muted = true, true
+		sh.rec.WriteFile = func(filename string, data []byte) error {
+			return nil
+		}
+		ckr := &core.Checker{Recorder: sh.rec}
+		err := ckr.CheckTranscript(ctx, bytes.NewReader(sh.Append))
+		sh.rec.WriteFile = nil
+		stdout.muted, stderr.muted = false, false
+		if err != nil {
+			return err
+		}
+		sh.rec.SetTranscript(sh.Append)
+	}
+
+	var lines []string // Input of an incomplete command.
 	for {
+		if len(lines) == 0 {
+			sh.rl.SetPrompt("$ ")
+		} else {
+			sh.rl.SetPrompt("> ")
+		}
 		line, err := sh.rl.Readline()
 		if errors.Is(err, io.EOF) {
 			return nil
 		}
+		if errors.Is(err, readline.ErrInterrupt) {
+			// Abandon the current input, like an ordinary shell.
+			lines = nil
+			continue
+		}
 		if err != nil {
 			return fmt.Errorf("readline: %w", err)
 		}
-		res, err := sh.rec.RunCommand(ctx, line)
-		if err != nil {
-			return err
+
+		// Comments and blank lines are recorded as-is, unless part of a command.
+		if len(lines) == 0 {
+			trimmed := strings.TrimSpace(line)
+			if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+				sh.rec.RecordComment(trimmed)
+				continue
+			}
+			if isMetaCommand(trimmed) {
+				if err := sh.runMetaCommand(ctx, trimmed); err != nil {
+					fmt.Fprintf(os.Stderr, "%v\n", err)
+				}
+				if sh.rec.Exited() {
+					return nil
+				}
+				continue
+			}
+		}
+
+		lines = append(lines, line)
+		command := strings.Join(lines, "\n")
+		if err := parseInput(command); err != nil {
+			if syntax.IsIncomplete(err) {
+				continue
+			}
+			fmt.Fprintf(os.Stderr, "%v\n", err)
+			lines = nil
+			continue
 		}
-		// TODO: Query cursor position. If not at start of line, println "% no-newline".
-		if res.ExitCode != 0 {
-			fmt.Fprintf(os.Stderr, "? %d\n", res.ExitCode)
+		lines = nil
+
+		if err := sh.runCommand(ctx, command); err != nil {
+			return err
 		}
 		if sh.rec.Exited() {
 			return nil
@@ -54,6 +125,71 @@ func (sh *Shell) Run(ctx context.Context) error {
 	}
 }
 
+func (sh *Shell) runCommand(ctx context.Context, command string) error {
+	res, err := sh.rec.RunCommand(ctx, command)
+	if err != nil {
+		return err
+	}
+	// Keep the next prompt off the end of unterminated output, and point out
+	// what was recorded for it.
+	if !res.AtLineStart {
+		fmt.Fprintln(os.Stderr)
+	}
+	for _, fd := range res.NoNewline {
+		fmt.Fprintf(os.Stderr, "%% no-newline (%s)\n", streamNames[fd])
+	}
+	// Elapsed time is only shown interactively, since it varies between runs.
+	if readline.IsTerminal(int(os.Stderr.Fd())) {
+		fmt.Fprintf(os.Stderr, "? %d (%s)\n", res.ExitCode, formatDuration(res.Duration))
+	} else {
+		fmt.Fprintf(os.Stderr, "? %d\n", res.ExitCode)
+	}
+	return nil
+}
+
+var streamNames = map[int]string{
+	1: "stdout",
+	2: "stderr",
+}
+
+func formatDuration(d time.Duration) string {
+	if d < time.Millisecond {
+		return d.Round(time.Microsecond).String()
+	}
+	return d.Round(time.Millisecond).String()
+}
+
+// parseInput checks that the input is a complete command. Use
+// syntax.IsIncomplete to detect input that may be completed by more lines.
+func parseInput(s string) error {
+	f, err := syntax.NewParser().Parse(strings.NewReader(s), "")
+	if err != nil {
+		return err
+	}
+	if len(f.Stmts) != 1 {
+		return fmt.Errorf("expected exactly one statement, got %d", len(f.Stmts))
+	}
+	return nil
+}
+
+// muteWriter discards writes while muted.
+type muteWriter struct {
+	w     io.Writer
+	muted bool
+}
+
+func (mw *muteWriter) Write(p []byte) (int, error) {
+	if mw.muted {
+		return len(p), nil
+	}
+	return mw.w.Write(p)
+}
+
+// Save atomically writes the transcript recorded so far to OutputPath.
+func (sh *Shell) Save() error {
+	return atomic.WriteFile(sh.OutputPath, bytes.NewReader(sh.rec.Transcript.Bytes()))
+}
+
 func (sh *Shell) DumpTranscript(w io.Writer) error {
 	_, err := io.Copy(w, &sh.rec.Transcript)
 	return err
@@ -6,6 +6,8 @@
 set -e
 
 export PATH="$PWD/bin:$PATH"
+# Transcripts that build Go code use this module from here.
+export TRANSCRIPT_MODULE_DIR="$PWD"
 if [[ $(which transcript) != "$PWD/bin/transcript" ]]; then
   echo 'built transcript not on PATH' 1>&2
   exit 1
@@ -4,54 +4,33 @@
 package main_test
 
 import (
+	"context"
 	"embed"
-	"io/fs"
 	"os"
-	"strings"
 	"testing"
 
 	"github.com/deref/transcript/cmdtest"
-	"github.com/stretchr/testify/assert"
+	"github.com/deref/transcript/internal/cli"
 )
 
-//go:embed tests/*
+//go:embed all:tests
 var tests embed.FS
 
+func TestMain(m *testing.M) {
+	// Transcripts run the transcript command built into this test binary.
+	cmdtest.Main(m, map[string]func() int{
+		"transcript": func() int {
+			cli.Execute(context.Background())
+			return 0
+		},
+	})
+}
+
 func TestTranscript(t *testing.T) {
-	// Save original directory
-	originalDir, err := os.Getwd()
-	if !assert.NoError(t, err) {
-		return
+	// Transcripts that build Go code use this module from here.
+	dir, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
 	}
-	defer os.Chdir(originalDir)
-
-	err = fs.WalkDir(tests, "tests", func(path string, d fs.DirEntry, err error) error {
-		if !assert.NoError(t, err) {
-			return err
-		}
-		if d.IsDir() || !strings.HasSuffix(path, "test.cmdt") {
-			return nil
-		}
-
-		// Extract test directory from path (e.g., "tests/binary-output/test.cmdt" -> "tests/binary-output")
-		testDir := strings.TrimSuffix(path, "/test.cmdt")
-
-		f, err := tests.Open(path)
-		if !assert.NoError(t, err) {
-			return nil
-		}
-		defer f.Close()
-		t.Run("check:"+path, func(t *testing.T) {
-			// Change to the test directory before running the test
-			err := os.Chdir(testDir)
-			if !assert.NoError(t, err) {
-				return
-			}
-			defer os.Chdir(originalDir)
-
-			cmdtest.Check(t, f)
-		})
-		return nil
-	})
-	assert.NoError(t, err)
+	cmdtest.CheckFS(t, tests, "tests/*/test.cmdt", cmdtest.Env("TRANSCRIPT_MODULE_DIR="+dir))
 }